@@ -0,0 +1,306 @@
+package jwksclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RequestMutator can modify the JWKS request before it is sent, returning an error aborts the refresh
+type RequestMutator func(req *http.Request) error
+
+// WithHeaders adds static headers to the JWKS request
+func WithHeaders(headers http.Header) Option {
+	return func(c *Client) {
+		h := headers.Clone()
+
+		c.mutators = append(c.mutators, func(req *http.Request) error {
+			for k, v := range h {
+				req.Header[k] = append([]string(nil), v...)
+			}
+
+			return nil
+		})
+	}
+}
+
+// WithUserAgent sets the User-Agent header of the JWKS request
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.mutators = append(c.mutators, func(req *http.Request) error {
+			req.Header.Set("User-Agent", userAgent)
+			return nil
+		})
+	}
+}
+
+// WithRequestMutator adds a callback that modifies the JWKS request, mutators run in the order they were added
+func WithRequestMutator(m RequestMutator) Option {
+	return func(c *Client) {
+		c.mutators = append(c.mutators, m)
+	}
+}
+
+// WithBearerToken sets a static bearer token on the JWKS request
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.mutators = append(c.mutators, func(req *http.Request) error {
+			req.Header.Set("Authorization", "Bearer "+token)
+			return nil
+		})
+	}
+}
+
+// ClientCredentialsConfig configures the OAuth2 client credentials grant used to authenticate the JWKS request
+type ClientCredentialsConfig struct {
+	// URL of the token endpoint
+	TokenURL string
+
+	ClientID     string
+	ClientSecret string
+
+	// requested scopes, optional
+	Scopes []string
+
+	// additional parameters of the token request, e.g. audience
+	EndpointParams url.Values
+
+	// send the client credentials in the request body instead of the Authorization header
+	AuthInParams bool
+
+	// renew the token this long before it expires, default 30s
+	ExpiryDelta time.Duration
+}
+
+// WithClientCredentials acquires an access token with the client credentials grant and sends it as a bearer token
+// the token is cached until it expires and renewed when the JWKS endpoint responds with 401
+func WithClientCredentials(config ClientCredentialsConfig) Option {
+	return func(c *Client) {
+		c.clientCredentials = &clientCredentials{config: config}
+	}
+}
+
+func (cc *ClientCredentialsConfig) Validate() error {
+	if cc.TokenURL == "" {
+		return errors.New("token URL is required")
+	}
+
+	if cc.ClientID == "" {
+		return errors.New("client ID is required")
+	}
+
+	return nil
+}
+
+// clientCredentials caches the access token of the client credentials grant
+type clientCredentials struct {
+	config ClientCredentialsConfig
+
+	m         sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// getToken returns the cached token or fetches a new one
+func (cc *clientCredentials) getToken(ctx context.Context, httpClient *http.Client) (string, error) {
+	cc.m.Lock()
+	defer cc.m.Unlock()
+
+	expiryDelta := cc.config.ExpiryDelta
+	if expiryDelta == 0 {
+		expiryDelta = 30 * time.Second
+	}
+
+	if cc.token != "" && (cc.expiresAt.IsZero() || time.Now().Add(expiryDelta).Before(cc.expiresAt)) {
+		return cc.token, nil
+	}
+
+	tr, err := cc.fetchToken(ctx, httpClient)
+	if err != nil {
+		return "", err
+	}
+
+	cc.token = tr.AccessToken
+	cc.expiresAt = time.Time{}
+
+	if tr.ExpiresIn > 0 {
+		cc.expiresAt = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+
+	log.Debug().Time("expiresAt", cc.expiresAt).Msg("client credentials token acquired")
+
+	return cc.token, nil
+}
+
+// invalidate drops the cached token, the next request fetches a new one
+func (cc *clientCredentials) invalidate() {
+	cc.m.Lock()
+	defer cc.m.Unlock()
+
+	cc.token = ""
+	cc.expiresAt = time.Time{}
+}
+
+func (cc *clientCredentials) fetchToken(ctx context.Context, httpClient *http.Client) (*tokenResponse, error) {
+	form := url.Values{}
+	for k, v := range cc.config.EndpointParams {
+		form[k] = append([]string(nil), v...)
+	}
+
+	form.Set("grant_type", "client_credentials")
+
+	if len(cc.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(cc.config.Scopes, " "))
+	}
+
+	if cc.config.AuthInParams {
+		form.Set("client_id", cc.config.ClientID)
+		form.Set("client_secret", cc.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", cc.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("creating token request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if !cc.config.AuthInParams {
+		req.SetBasicAuth(url.QueryEscape(cc.config.ClientID), url.QueryEscape(cc.config.ClientSecret))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("performing token request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("reading token response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected token endpoint HTTP status code: %d", resp.StatusCode)
+	}
+
+	tr := &tokenResponse{}
+
+	if err := json.Unmarshal(body, tr); err != nil {
+		return nil, fmt.Errorf("unmarshalling token response: %w", err)
+	}
+
+	if tr.AccessToken == "" {
+		return nil, errors.New("token response has no access_token")
+	}
+
+	if tr.TokenType != "" && !strings.EqualFold(tr.TokenType, "bearer") {
+		return nil, fmt.Errorf("unsupported token type: %s", tr.TokenType)
+	}
+
+	return tr, nil
+}
+
+// newRequest creates the JWKS request and applies the headers, mutators and the access token
+func (c *Client) newRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, http.NoBody)
+	if err != nil {
+		return nil, &TransportError{Op: "creating request", Err: err}
+	}
+
+	for _, m := range c.mutators {
+		if err := m(req); err != nil {
+			return nil, &TransportError{Op: "mutating request", Err: err}
+		}
+	}
+
+	if c.clientCredentials != nil {
+		token, err := c.clientCredentials.getToken(ctx, c.httpClient)
+		if err != nil {
+			return nil, &TransportError{Op: "getting access token", Err: err}
+		}
+
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return req, nil
+}
+
+// do sends the JWKS request, on 401 it renews the access token and retries once
+func (c *Client) do(ctx context.Context, url string) (*http.Response, error) {
+	req, err := c.newRequest(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized || c.clientCredentials == nil {
+		return resp, nil
+	}
+
+	// the token may have been revoked before its expiry
+	log.Info().Msg("JWKS endpoint responded with 401, renewing the access token")
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+
+	c.clientCredentials.invalidate()
+
+	if req, err = c.newRequest(ctx, url); err != nil {
+		return nil, err
+	}
+
+	return c.send(req)
+}
+
+// doPlain sends a GET request without the headers, mutators and access token of the JWKS request
+func (c *Client) doPlain(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, http.NoBody)
+	if err != nil {
+		return nil, &TransportError{Op: "creating request", Err: err}
+	}
+
+	return c.send(req)
+}
+
+// send performs the request and checks the SPKI pins of the response
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		var pinErr *PinMismatchError
+		if errors.As(err, &pinErr) {
+			return nil, &PolicyError{Err: pinErr}
+		}
+
+		return nil, &TransportError{Op: "performing request", Err: err}
+	}
+
+	// the pins apply to the JWKS host only, not to e.g. a shadow URL on another host
+	if c.spkiPins != nil && req.URL.Hostname() == c.spkiPins.host {
+		if err := c.spkiPins.check(resp.TLS); err != nil {
+			resp.Body.Close()
+			return nil, &PolicyError{Err: err}
+		}
+	}
+
+	return resp, nil
+}
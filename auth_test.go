@@ -0,0 +1,134 @@
+package jwksclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientCredentials(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// expires_in of the issued tokens in seconds
+		expiresIn int
+
+		expiryDelta time.Duration
+
+		// the JWKS endpoint rejects the first n tokens with 401
+		rejectTokens int32
+
+		wantTokenRequests int32
+		wantJWKSRequests  int32
+		wantStatus        int
+	}{
+		{
+			name:              "token is cached between refreshes",
+			expiresIn:         3600,
+			wantTokenRequests: 1,
+			wantJWKSRequests:  2,
+		},
+		{
+			name:              "token is renewed before it expires",
+			expiresIn:         20,
+			wantTokenRequests: 2,
+			wantJWKSRequests:  2,
+		},
+		{
+			name:              "expiry delta is configurable",
+			expiresIn:         20,
+			expiryDelta:       time.Second,
+			wantTokenRequests: 1,
+			wantJWKSRequests:  2,
+		},
+		{
+			name:              "401 renews the token and retries once",
+			expiresIn:         3600,
+			rejectTokens:      1,
+			wantTokenRequests: 2,
+			wantJWKSRequests:  2,
+		},
+		{
+			name:              "a second 401 is not retried",
+			expiresIn:         3600,
+			rejectTokens:      100,
+			wantTokenRequests: 2,
+			wantJWKSRequests:  2,
+			wantStatus:        http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tokenRequests, jwksRequests int32
+
+			tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&tokenRequests, 1)
+
+				if id, secret, _ := r.BasicAuth(); id != "id" || secret != "secret" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"access_token":"t%d","token_type":"Bearer","expires_in":%d}`, n, tt.expiresIn)
+			}))
+			defer tokenSrv.Close()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&jwksRequests, 1)
+
+				var n int32
+				if _, err := fmt.Sscanf(r.Header.Get("Authorization"), "Bearer t%d", &n); err != nil || n <= tt.rejectTokens {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
+				w.Write(mkJWKS("k1"))
+			}))
+			defer srv.Close()
+
+			cfg := NewConfig()
+			cfg.URL = srv.URL
+
+			c, err := New(cfg, WithClientCredentials(ClientCredentialsConfig{
+				TokenURL:     tokenSrv.URL,
+				ClientID:     "id",
+				ClientSecret: "secret",
+				ExpiryDelta:  tt.expiryDelta,
+			}))
+			if err != nil {
+				t.Fatal("New() error:", err)
+			}
+
+			refreshes := 2
+			if tt.rejectTokens > 0 {
+				refreshes = 1
+			}
+
+			for i := 0; i < refreshes; i++ {
+				_, err = c.Refresh(true)
+			}
+
+			var statusErr *HTTPStatusError
+			switch {
+			case tt.wantStatus == 0 && err != nil:
+				t.Errorf("Refresh() error: %v", err)
+
+			case tt.wantStatus != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus):
+				t.Errorf("Refresh() error = %v, want HTTP status %d", err, tt.wantStatus)
+			}
+
+			if got := atomic.LoadInt32(&tokenRequests); got != tt.wantTokenRequests {
+				t.Errorf("got %d token requests, want %d", got, tt.wantTokenRequests)
+			}
+
+			if got := atomic.LoadInt32(&jwksRequests); got != tt.wantJWKSRequests {
+				t.Errorf("got %d JWKS requests, want %d", got, tt.wantJWKSRequests)
+			}
+		})
+	}
+}
@@ -29,7 +29,7 @@ func (c *Client) autoRefresh() {
 			}
 
 			if refreshed && c.rcb != nil {
-				ks, err := c.GetKeySet()
+				ks, err := c.keySet()
 				if err != nil {
 					log.Error().Err(err).Msg("error getting key set")
 				}
@@ -2,7 +2,7 @@ package jwksclient
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -50,7 +50,7 @@ func WithWaitGroup(wg *sync.WaitGroup) Option {
 	}
 }
 
-// WithHttpClient sets the http client to use, if not specified the default client is used
+// WithHttpClient sets the http client to use, if not specified a client configured from Config is used
 func WithHttpClient(client *http.Client) Option {
 	return func(c *Client) {
 		c.httpClient = client
@@ -64,6 +64,14 @@ func WithWaitFirstFetch() Option {
 	}
 }
 
+// WithReadThrough makes GetKeySet refresh the cache on demand, useful when no refresher is running
+// a missing key set is fetched synchronously, an expired one is refreshed in the background
+func WithReadThrough() Option {
+	return func(c *Client) {
+		c.readThrough = true
+	}
+}
+
 type Client struct {
 	config Config
 
@@ -72,6 +80,20 @@ type Client struct {
 	autoRefreshInterval time.Duration
 	wg                  *sync.WaitGroup
 	rcb                 RefreshCallback
+	readThrough         bool
+	signed              *signedJWKS
+	x5cPolicy           *X5CPolicy
+	mutators            []RequestMutator
+	clientCredentials   *clientCredentials
+	pins                []string
+	spkiPins            *spkiPins
+
+	// read-through state
+	readThroughM       sync.Mutex
+	readThroughRunning int32
+
+	// serializes Refresh, so the source is called from a single goroutine at a time
+	refreshM sync.Mutex
 
 	httpClient *http.Client
 	refresh    func() (bool, error)
@@ -84,6 +106,18 @@ type Client struct {
 	cachedJWKSet      jwk.Set
 	cachedError       error
 	keysStaleSince    time.Time
+
+	// status data
+	lastAttempt    time.Time
+	lastSuccess    time.Time
+	lastStatusCode int
+	cacheDecision  CacheDecision
+	rejectedKeys   map[string]string
+	shrinkage      shrinkage
+
+	source     Source
+	shadow     *shadow
+	shadowAuth bool
 }
 
 // New creates a new JWKS client
@@ -92,9 +126,11 @@ func New(config Config, opts ...Option) (*Client, error) {
 		return nil, fmt.Errorf("validating config: %w", err)
 	}
 
+	config = config.withDefaults()
+
 	cl := &Client{
 		config:     config,
-		httpClient: http.DefaultClient,
+		httpClient: newHTTPClient(config),
 		ctx:        context.Background(),
 	}
 
@@ -102,6 +138,57 @@ func New(config Config, opts ...Option) (*Client, error) {
 		opt(cl)
 	}
 
+	if cl.source == nil {
+		src, err := cl.newSource(cl.config.URL)
+		if err != nil {
+			return nil, fmt.Errorf("creating source: %w", err)
+		}
+
+		cl.source = src
+	}
+
+	if cl.shadow != nil {
+		src, err := cl.newSource(cl.shadow.url)
+		if err != nil {
+			return nil, fmt.Errorf("creating shadow source: %w", err)
+		}
+
+		if hs, ok := src.(*httpSource); ok {
+			// the credentials of the primary URL go to the shadow only on request
+			hs.plain = !cl.shadowAuth
+		}
+
+		cl.shadow.source = src
+	}
+
+	if cl.signed != nil {
+		if err := cl.signed.validate(); err != nil {
+			return nil, fmt.Errorf("validating options: %w", err)
+		}
+	}
+
+	if len(cl.pins) > 0 {
+		pins, err := newSPKIPins(cl.config.URL, cl.pins)
+		if err != nil {
+			return nil, fmt.Errorf("validating SPKI pins: %w", err)
+		}
+
+		cl.spkiPins = pins
+		cl.httpClient = pins.wrapClient(cl.httpClient)
+	}
+
+	if cl.clientCredentials != nil {
+		if err := cl.clientCredentials.config.Validate(); err != nil {
+			return nil, fmt.Errorf("validating client credentials: %w", err)
+		}
+	}
+
+	if cl.x5cPolicy != nil {
+		if err := cl.x5cPolicy.validate(); err != nil {
+			return nil, fmt.Errorf("validating options: %w", err)
+		}
+	}
+
 	cl.refresh = func() (bool, error) {
 		refreshed, err := cl.Refresh(false)
 		if err != nil {
@@ -125,7 +212,7 @@ func New(config Config, opts ...Option) (*Client, error) {
 		if r, err := cl.refresh(); err != nil {
 			return cl, err
 		} else if r && cl.rcb != nil {
-			ks, err := cl.GetKeySet()
+			ks, err := cl.keySet()
 			if err != nil {
 				return nil, err
 			}
@@ -146,14 +233,30 @@ func New(config Config, opts ...Option) (*Client, error) {
 }
 
 // GetKeySet returns the loaded key set
-func (c *Client) GetKeySet() (jwk.Set, error) {
+// with WithReadThrough the cache is refreshed on demand, the context bounds the wait for a synchronous fetch
+func (c *Client) GetKeySet(ctx context.Context) (jwk.Set, error) {
+	if c.readThrough {
+		if err := c.readThroughRefresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.keySet()
+}
+
+// keySet returns the cached key set honoring the KeepStaleKeys config option
+func (c *Client) keySet() (jwk.Set, error) {
 	c.m.RLock()
 	defer c.m.RUnlock()
 
-	if c.cachedError != nil && (c.keysStaleSince.Add(c.config.KeepStaleKeys).Before(time.Now()) || c.cachedJWKSet == nil) {
+	if c.cachedError != nil && c.cachedJWKSet == nil {
 		return nil, c.cachedError
 	}
 
+	if c.cachedError != nil && c.keysStaleSince.Add(c.config.KeepStaleKeys).Before(time.Now()) {
+		return nil, &StaleKeysExpiredError{KeysStaleSince: c.keysStaleSince, Err: c.cachedError}
+	}
+
 	if c.cachedJWKSet == nil {
 		return nil, &ErrKeysNotFetched{}
 	}
@@ -190,7 +293,12 @@ func (c *Client) Refresher(ctx context.Context) error {
 }
 
 // Refresh fetches the JWKS from the endpoint and updates the cache
+// refreshed is false when the cache is still valid, the source reports no change
+// or the new key set is held by the shrinkage check, see Status.PendingKeySet
 func (c *Client) Refresh(force bool) (refreshed bool, _err error) {
+	c.refreshM.Lock()
+	defer c.refreshM.Unlock()
+
 	c.m.RLock()
 	cacheExpiresAfter := c.cacheExpiresAfter
 	c.m.RUnlock()
@@ -200,66 +308,175 @@ func (c *Client) Refresh(force bool) (refreshed bool, _err error) {
 		return false, nil
 	}
 
-	ks, resp, headers, err := c.get()
+	ks, resp, err := c.get(c.source)
+
+	if resp != nil && resp.NotModified {
+		c.m.Lock()
+		defer c.m.Unlock()
+
+		if held := c.shrinkage.held; held != nil && c.cachedError == nil {
+			// the source still serves the pending key set, this counts as a confirmation
+			return c.store(*held, nil), nil
+		}
+
+		// the last result stands, only the expiration moves
+		c.lastAttempt = time.Now()
+		c.updateExpiresAfter(c.cachedHeaders, c.cachedError)
+
+		return false, c.cachedError
+	}
+
+	r := fetchResult{ks: ks}
+
+	if resp != nil {
+		r.headers = resp.Header
+		r.body = resp.Body
+		r.statusCode = resp.StatusCode
+	}
+
+	if err == nil && c.shadow != nil {
+		c.shadow.compareAsync(c, ks, r.headers)
+	}
+
+	if err == nil && c.x5cPolicy != nil {
+		r.ks, r.rejected = c.x5cPolicy.filter(ks, time.Now())
+
+		if len(r.rejected) > 0 {
+			log.Warn().Interface("rejected", r.rejected).Msg("keys excluded by x5c validation")
+		}
+	}
 
 	c.m.Lock()
 	defer c.m.Unlock()
 
-	if err != nil && c.keysStaleSince.IsZero() {
-		// update stale keys timestamp on the first error
-		c.keysStaleSince = time.Now()
-	}
+	return c.store(r, err), err
+}
+
+// fetchResult is a fetched key set with its response
+type fetchResult struct {
+	ks         jwk.Set
+	headers    http.Header
+	body       []byte
+	statusCode int
 
-	c.cachedHeaders = headers
-	c.cachedResponse = resp
+	// the keys excluded by the x5c validation
+	rejected map[string]string
+}
+
+// store records the result of a fetch, it returns false when the key set is held by the shrinkage check
+// must be called with the lock held
+func (c *Client) store(r fetchResult, err error) bool {
+	c.lastAttempt = time.Now()
+	c.lastStatusCode = r.statusCode
 	c.cachedError = err
 
-	if err == nil {
+	held := false
+
+	if err != nil {
+		if c.keysStaleSince.IsZero() {
+			// update stale keys timestamp on the first error
+			c.keysStaleSince = time.Now()
+		}
+	} else {
 		c.keysStaleSince = time.Time{}
-		c.cachedJWKSet = ks
+
+		accepted := c.checkShrinkage(r.ks, c.lastAttempt)
+		held = accepted == nil
+
+		if held {
+			c.shrinkage.held = &r
+		} else {
+			c.shrinkage.held = nil
+			c.lastSuccess = c.lastAttempt
+			c.rejectedKeys = r.rejected
+			c.cachedJWKSet = accepted
+		}
+	}
+
+	if !held {
+		// the response of a held key set is not kept, the cached one matches the served keys
+		c.cachedHeaders = r.headers
+		c.cachedResponse = r.body
 	}
 
-	c.updateExpiresAfter(headers, err)
+	c.updateExpiresAfter(r.headers, err)
 
-	return true, err
+	if c.shrinkage.pending != nil && c.cacheExpiresAfter.After(c.lastAttempt.Add(c.config.CacheMin)) {
+		// confirm the pending key set sooner
+		c.cacheExpiresAfter = c.lastAttempt.Add(c.config.CacheMin)
+	}
+
+	return !held
 }
 
-// get performs a GET request and returns the raw body, headers and the JWK set
-func (c *Client) get() (jwkSet jwk.Set, responseBody []byte, headers http.Header, _err error) {
-	req, err := http.NewRequestWithContext(c.ctx, "GET", c.config.URL, http.NoBody)
+// get fetches the key set from the source, validates and parses it
+// the response is returned when available, also on errors
+func (c *Client) get(src Source) (jwk.Set, *SourceResponse, error) {
+	resp, err := src.Fetch(c.ctx)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("creating request: %w", err)
+		var transportErr *TransportError
+		var policyErr *PolicyError
+		var statusErr *HTTPStatusError
+
+		if !errors.As(err, &transportErr) && !errors.As(err, &policyErr) && !errors.As(err, &statusErr) {
+			// errors of custom sources
+			err = &TransportError{Op: "fetching from source", Err: err}
+		}
+
+		return nil, resp, err
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("performing request: %w", err)
+	if resp.NotModified {
+		return nil, resp, nil
+	}
+
+	if resp.StatusCode != 0 && resp.StatusCode != http.StatusOK {
+		return nil, resp, newHTTPStatusError(resp.StatusCode, resp.Header, resp.Body)
 	}
 
-	defer resp.Body.Close()
+	if c.config.MaxResponseSize > 0 && int64(len(resp.Body)) > c.config.MaxResponseSize {
+		return nil, resp, &PolicyError{Err: &ResponseTooLargeError{Limit: c.config.MaxResponseSize}}
+	}
+
+	if c.config.CheckContentType {
+		if err := c.checkContentType(resp.Header.Get("Content-Type")); err != nil {
+			return nil, resp, &PolicyError{Err: err}
+		}
+	}
 
-	body, err := io.ReadAll(resp.Body)
+	kSet, err := c.parseKeySet(resp.Body)
 	if err != nil {
-		return nil, nil, resp.Header, fmt.Errorf("reading response body: %w", err)
+		return nil, resp, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, body, resp.Header, fmt.Errorf("unexpected HTTP status code: %d", resp.StatusCode)
+	return kSet, resp, nil
+}
+
+// readBody reads the response body honoring the MaxResponseSize config option
+func (c *Client) readBody(r io.Reader) ([]byte, error) {
+	if c.config.MaxResponseSize > 0 {
+		// read one byte more to detect the bodies exceeding the limit
+		r = io.LimitReader(r, c.config.MaxResponseSize+1)
 	}
 
-	kSet := jwk.NewSet()
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &TransportError{Op: "reading response body", Err: err}
+	}
 
-	if err := json.Unmarshal(body, kSet); err != nil {
-		return nil, body, resp.Header, fmt.Errorf("unmarshalling JSON: %w", err)
+	if c.config.MaxResponseSize > 0 && int64(len(body)) > c.config.MaxResponseSize {
+		return nil, &PolicyError{Err: &ResponseTooLargeError{Limit: c.config.MaxResponseSize}}
 	}
 
-	return kSet, body, resp.Header, nil
+	return body, nil
 }
 
 func (c *Client) updateExpiresAfter(headers http.Header, err error) {
 	now := time.Now()
 
 	if err != nil {
+		c.cacheDecision = CacheDecisionError
+
 		if c.config.CacheErrors > 0 {
 			c.cacheExpiresAfter = now.Add(c.config.CacheErrors)
 		}
@@ -302,5 +519,16 @@ func (c *Client) updateExpiresAfter(headers http.Header, err error) {
 
 	l.Msg("cache headers parsed")
 
+	switch {
+	case cacheMaxHit:
+		c.cacheDecision = CacheDecisionMaxClamped
+	case cacheMinHit:
+		c.cacheDecision = CacheDecisionMinClamped
+	case cacheHeadersPresent:
+		c.cacheDecision = CacheDecisionHeaders
+	default:
+		c.cacheDecision = CacheDecisionDefault
+	}
+
 	c.cacheExpiresAfter = expiresAfter
 }
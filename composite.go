@@ -0,0 +1,325 @@
+package jwksclient
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+/*
+	Composite merges the key sets of several clients and keyloaders into one jwk.Set.
+	Every key is a public copy tagged with the name of its member in the SourceTagKey field.
+	The members go stale independently, a failing member is left out of the merged set
+	until it recovers. Keys with the same kid and thumbprint from several members are merged,
+	other kid conflicts are resolved by the ConflictPolicy.
+*/
+
+// SourceTagKey is the key field holding the name of the composite member the key came from
+const SourceTagKey = "jwksclient_source"
+
+// ConflictPolicy decides what happens when members publish different keys with the same kid
+type ConflictPolicy int
+
+const (
+	// ConflictFirstWins keeps the key of the member added first
+	ConflictFirstWins ConflictPolicy = iota
+
+	// ConflictKeepAll keeps all the keys, verifiers have to try each of them
+	ConflictKeepAll
+
+	// ConflictDropAll leaves out all the keys with the conflicting kid
+	ConflictDropAll
+
+	// ConflictError makes KeySet return a KidConflictError
+	ConflictError
+)
+
+// KidConflictError is returned by Composite.KeySet with ConflictError
+type KidConflictError struct {
+	KeyID   string
+	Members []string
+}
+
+func (e *KidConflictError) Error() string {
+	return fmt.Sprintf("kid %q is published by several members with different keys: %s", e.KeyID, strings.Join(e.Members, ", "))
+}
+
+// CompositeError is returned by Composite.KeySet when none of the members has keys
+type CompositeError struct {
+	// the errors by member name
+	Errors map[string]error
+}
+
+func (e *CompositeError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, name+": "+e.Errors[name].Error())
+	}
+
+	return "no composite member has keys: " + strings.Join(msgs, "; ")
+}
+
+// CompositeMember is a named key set source of a Composite
+// for a keyloader use its KeySet method, e.g. CompositeMember{Name: "local", KeySet: kl.KeySet},
+// only the public keys of a private keyloader are merged
+type CompositeMember struct {
+	Name   string
+	KeySet func(ctx context.Context) (jwk.Set, error)
+}
+
+// ClientMember makes a composite member from a client
+func ClientMember(name string, c *Client) CompositeMember {
+	return CompositeMember{
+		Name:   name,
+		KeySet: c.GetKeySet,
+	}
+}
+
+type CompositeOption func(*Composite)
+
+// WithConflictPolicy sets the kid conflict policy, the default is ConflictFirstWins
+func WithConflictPolicy(p ConflictPolicy) CompositeOption {
+	return func(c *Composite) {
+		c.policy = p
+	}
+}
+
+// WithCompositeChangeCallback sets the callback called when the merged key set changes
+func WithCompositeChangeCallback(cb RefreshCallback) CompositeOption {
+	return func(c *Composite) {
+		c.onChange = cb
+	}
+}
+
+type Composite struct {
+	policy   ConflictPolicy
+	onChange RefreshCallback
+
+	m       sync.Mutex
+	members []CompositeMember
+
+	// the merged set is reused while the member sets are the same objects
+	memberSets  []jwk.Set
+	merged      jwk.Set
+	mergedErr   error
+	fingerprint string
+}
+
+// NewComposite creates a composite of the members, more members can be added with Add
+func NewComposite(members []CompositeMember, opts ...CompositeOption) *Composite {
+	c := &Composite{
+		members: append([]CompositeMember(nil), members...),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Add adds a member, its keys lose kid conflicts against the members added before it with ConflictFirstWins
+func (c *Composite) Add(m CompositeMember) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.members = append(c.members, m)
+	c.memberSets = nil
+}
+
+// ClientCallback returns a refresh callback for the member clients, it updates the composite when a client refreshes
+// pass it to WithAutoRefreshCallback
+func (c *Composite) ClientCallback() RefreshCallback {
+	return func(jwk.Set, error) {
+		c.Update(context.Background())
+	}
+}
+
+// KeyloaderCallback returns a refresh callback for the member keyloaders,
+// pass it to private.WithRefreshCallback or public.WithRefreshCallback
+func (c *Composite) KeyloaderCallback() func(jwk.Set) {
+	return func(jwk.Set) {
+		c.Update(context.Background())
+	}
+}
+
+// Update merges the member key sets and calls the change callback if the result changed
+func (c *Composite) Update(ctx context.Context) {
+	if _, err := c.KeySet(ctx); err != nil {
+		log.Error().Err(err).Msg("updating composite key set")
+	}
+}
+
+// KeySet returns the merged key set of the members that have keys
+func (c *Composite) KeySet(ctx context.Context) (jwk.Set, error) {
+	c.m.Lock()
+	members := append([]CompositeMember(nil), c.members...)
+	c.m.Unlock()
+
+	if len(members) == 0 {
+		return nil, errors.New("composite has no members")
+	}
+
+	sets := make([]jwk.Set, len(members))
+	errs := map[string]error{}
+
+	for i, m := range members {
+		ks, err := m.KeySet(ctx)
+		if err != nil {
+			log.Debug().Err(err).Str("member", m.Name).Msg("composite member has no keys")
+			errs[m.Name] = err
+			continue
+		}
+
+		sets[i] = ks
+	}
+
+	c.m.Lock()
+
+	if c.memberSets != nil && sameSets(c.memberSets, sets) {
+		defer c.m.Unlock()
+		return c.merged, c.mergedErr
+	}
+
+	var merged jwk.Set
+	var fingerprint string
+	var err error
+
+	if len(errs) == len(members) {
+		err = &CompositeError{Errors: errs}
+	} else {
+		merged, fingerprint, err = c.merge(members, sets)
+	}
+
+	c.memberSets = sets
+	c.merged, c.mergedErr = merged, err
+
+	changed := fingerprint != c.fingerprint
+	c.fingerprint = fingerprint
+
+	c.m.Unlock()
+
+	// called without the lock, the callback may use the composite
+	if changed && c.onChange != nil {
+		c.onChange(merged, err)
+	}
+
+	return merged, err
+}
+
+type taggedKey struct {
+	member     string
+	thumbprint string
+	key        jwk.Key
+}
+
+// merge combines the sets, it returns the merged set and a fingerprint of its content
+func (c *Composite) merge(members []CompositeMember, sets []jwk.Set) (jwk.Set, string, error) {
+	byKid := map[string][]taggedKey{}
+	var kids []string
+
+	for i, ks := range sets {
+		if ks == nil {
+			continue
+		}
+
+		for it := ks.Iterate(context.Background()); it.Next(context.Background()); {
+			key, err := jwk.PublicKeyOf(it.Pair().Value)
+			if err != nil {
+				return nil, "", fmt.Errorf("public key of member %s: %w", members[i].Name, err)
+			}
+
+			tp, err := key.Thumbprint(crypto.SHA256)
+			if err != nil {
+				return nil, "", fmt.Errorf("thumbprint of member %s: %w", members[i].Name, err)
+			}
+
+			kid := key.KeyID()
+			tk := taggedKey{member: members[i].Name, thumbprint: base64.RawURLEncoding.EncodeToString(tp), key: key}
+
+			if _, ok := byKid[kid]; !ok {
+				kids = append(kids, kid)
+			}
+
+			byKid[kid] = appendUnique(byKid[kid], tk)
+		}
+	}
+
+	merged := jwk.NewSet()
+	var fp strings.Builder
+
+	for _, kid := range kids {
+		keys := byKid[kid]
+
+		if len(keys) > 1 {
+			memberNames := make([]string, 0, len(keys))
+			for _, tk := range keys {
+				memberNames = append(memberNames, tk.member)
+			}
+
+			log.Warn().Str("kid", kid).Strs("members", memberNames).Msg("composite kid conflict")
+
+			switch c.policy {
+			case ConflictFirstWins:
+				keys = keys[:1]
+
+			case ConflictDropAll:
+				continue
+
+			case ConflictError:
+				return nil, "", &KidConflictError{KeyID: kid, Members: memberNames}
+			}
+		}
+
+		for _, tk := range keys {
+			if err := tk.key.Set(SourceTagKey, tk.member); err != nil {
+				return nil, "", fmt.Errorf("tagging key %s: %w", kid, err)
+			}
+
+			merged.Add(tk.key)
+
+			fmt.Fprintf(&fp, "%s|%s|%s\n", tk.member, kid, tk.thumbprint)
+		}
+	}
+
+	return merged, fp.String(), nil
+}
+
+// appendUnique adds the key unless the same key is already there, the first member publishing it keeps the tag
+func appendUnique(keys []taggedKey, tk taggedKey) []taggedKey {
+	for _, k := range keys {
+		if k.thumbprint == tk.thumbprint {
+			return keys
+		}
+	}
+
+	return append(keys, tk)
+}
+
+func sameSets(a, b []jwk.Set) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,218 @@
+package jwksclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+func TestCompositeMerge(t *testing.T) {
+	errDown := errors.New("member down")
+
+	tests := []struct {
+		name   string
+		policy ConflictPolicy
+
+		// the members by name, a nil set is a failing member
+		members []string
+		sets    map[string]jwk.Set
+
+		// the merged keys as member/kid
+		want         []string
+		wantConflict bool
+		wantAllDown  bool
+	}{
+		{
+			name:    "sets are merged and tagged",
+			members: []string{"a", "b"},
+			sets:    map[string]jwk.Set{"a": mkSet(t, "k1"), "b": mkSet(t, "k2", "k3")},
+			want:    []string{"a/k1", "b/k2", "b/k3"},
+		},
+		{
+			name:    "the same key of several members is merged",
+			members: []string{"a", "b"},
+			sets:    map[string]jwk.Set{"a": mkSet(t, "k1"), "b": mkSet(t, "k1", "k2")},
+			want:    []string{"a/k1", "b/k2"},
+		},
+		{
+			name:    "a failing member is left out",
+			members: []string{"a", "b"},
+			sets:    map[string]jwk.Set{"a": nil, "b": mkSet(t, "k2")},
+			want:    []string{"b/k2"},
+		},
+		{
+			name:        "all members failing",
+			members:     []string{"a", "b"},
+			sets:        map[string]jwk.Set{"a": nil, "b": nil},
+			wantAllDown: true,
+		},
+		{
+			name:    "conflict, first wins",
+			policy:  ConflictFirstWins,
+			members: []string{"a", "b"},
+			sets:    map[string]jwk.Set{"a": mkSet(t, "k1=x"), "b": mkSet(t, "k1=y", "k2")},
+			want:    []string{"a/k1", "b/k2"},
+		},
+		{
+			name:    "conflict, keep all",
+			policy:  ConflictKeepAll,
+			members: []string{"a", "b"},
+			sets:    map[string]jwk.Set{"a": mkSet(t, "k1=x"), "b": mkSet(t, "k1=y", "k2")},
+			want:    []string{"a/k1", "b/k1", "b/k2"},
+		},
+		{
+			name:    "conflict, drop all",
+			policy:  ConflictDropAll,
+			members: []string{"a", "b"},
+			sets:    map[string]jwk.Set{"a": mkSet(t, "k1=x"), "b": mkSet(t, "k1=y", "k2")},
+			want:    []string{"b/k2"},
+		},
+		{
+			name:         "conflict, error",
+			policy:       ConflictError,
+			members:      []string{"a", "b"},
+			sets:         map[string]jwk.Set{"a": mkSet(t, "k1=x"), "b": mkSet(t, "k1=y", "k2")},
+			wantConflict: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			members := make([]CompositeMember, 0, len(tt.members))
+			for _, name := range tt.members {
+				members = append(members, staticMember(name, tt.sets[name], errDown))
+			}
+
+			c := NewComposite(members, WithConflictPolicy(tt.policy))
+
+			ks, err := c.KeySet(context.Background())
+
+			var conflictErr *KidConflictError
+			if got := errors.As(err, &conflictErr); got != tt.wantConflict {
+				t.Fatalf("KeySet() error = %v, want KidConflictError %v", err, tt.wantConflict)
+			}
+
+			if tt.wantConflict && (conflictErr.KeyID != "k1" || !reflect.DeepEqual(conflictErr.Members, []string{"a", "b"})) {
+				t.Errorf("got conflict %+v, want k1 of a, b", conflictErr)
+			}
+
+			var compositeErr *CompositeError
+			if got := errors.As(err, &compositeErr); got != tt.wantAllDown {
+				t.Fatalf("KeySet() error = %v, want CompositeError %v", err, tt.wantAllDown)
+			}
+
+			if tt.wantAllDown && !errors.Is(compositeErr.Errors["a"], errDown) {
+				t.Errorf("got member errors %v, want the member error", compositeErr.Errors)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got := taggedKeys(t, ks); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got keys %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompositeChangeCallback(t *testing.T) {
+	set := mkSet(t, "k1")
+
+	member := CompositeMember{
+		Name:   "a",
+		KeySet: func(context.Context) (jwk.Set, error) { return set, nil },
+	}
+
+	var calls []string
+
+	c := NewComposite([]CompositeMember{member}, WithCompositeChangeCallback(func(ks jwk.Set, err error) {
+		calls = append(calls, strings.Join(taggedKeys(t, ks), ","))
+	}))
+
+	steps := []struct {
+		name      string
+		set       jwk.Set
+		wantCalls int
+	}{
+		{name: "first merge", set: set, wantCalls: 1},
+		{name: "same set", set: set, wantCalls: 1},
+		{name: "new set with the same keys", set: mkSet(t, "k1"), wantCalls: 1},
+		{name: "new keys", set: mkSet(t, "k1", "k2"), wantCalls: 2},
+		{name: "changed key material", set: mkSet(t, "k1", "k2=y"), wantCalls: 3},
+	}
+	for _, s := range steps {
+		set = s.set
+
+		c.Update(context.Background())
+
+		if len(calls) != s.wantCalls {
+			t.Errorf("%s: got %d callback calls, want %d", s.name, len(calls), s.wantCalls)
+		}
+	}
+
+	if want := []string{"a/k1", "a/k1,a/k2", "a/k1,a/k2"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("got callbacks %v, want %v", calls, want)
+	}
+}
+
+// mkSet returns a set of symmetric keys, each given as kid or kid=secret, the secret defaults to the kid
+func mkSet(t *testing.T, keys ...string) jwk.Set {
+	t.Helper()
+
+	ks := jwk.NewSet()
+
+	for _, k := range keys {
+		kid, secret, ok := strings.Cut(k, "=")
+		if !ok {
+			secret = kid
+		}
+
+		key, err := jwk.New([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := key.Set(jwk.KeyIDKey, kid); err != nil {
+			t.Fatal(err)
+		}
+
+		ks.Add(key)
+	}
+
+	return ks
+}
+
+// staticMember returns a member serving the set, or failing with err when the set is nil
+func staticMember(name string, ks jwk.Set, err error) CompositeMember {
+	return CompositeMember{
+		Name: name,
+		KeySet: func(context.Context) (jwk.Set, error) {
+			if ks == nil {
+				return nil, err
+			}
+
+			return ks, nil
+		},
+	}
+}
+
+// taggedKeys returns the keys of the set as member/kid
+func taggedKeys(t *testing.T, ks jwk.Set) []string {
+	t.Helper()
+
+	var keys []string
+
+	for it := ks.Iterate(context.Background()); it.Next(context.Background()); {
+		key := it.Pair().Value.(jwk.Key)
+
+		member, _ := key.Get(SourceTagKey)
+		keys = append(keys, fmt.Sprintf("%s/%s", member, key.KeyID()))
+	}
+
+	return keys
+}
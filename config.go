@@ -6,7 +6,7 @@ import (
 )
 
 type Config struct {
-	// URL of the JWKS endpoint
+	// URL of the JWKS endpoint, the scheme selects the source: http, https, file, data or one registered with RegisterSource
 	URL string
 
 	// cache successful requests at least for this duration regardles of cache headers
@@ -23,6 +23,45 @@ type Config struct {
 
 	// keep the old keys for this duration after an error, 0 means no caching of stale keys
 	KeepStaleKeys time.Duration
+
+	// the following settings apply to the default http client, they are ignored when WithHttpClient is used
+	// a timeout of 0 means the default of NewConfig, a negative timeout means no timeout
+
+	// timeout for establishing the TCP connection
+	ConnectTimeout time.Duration
+
+	// timeout for the TLS handshake
+	TLSHandshakeTimeout time.Duration
+
+	// overall timeout of the request, including reading the response body
+	RequestTimeout time.Duration
+
+	// maximum number of redirects to follow, 0 means the default of NewConfig, negative means none
+	// redirects from https to http are always refused
+	MaxRedirects int
+
+	// maximum size of the response body in bytes, applies to any http client,
+	// 0 means the default of NewConfig, negative means no limit
+	MaxResponseSize int64
+
+	// reject responses with a Content-Type not in AllowedContentTypes
+	CheckContentType bool
+
+	// the accepted content types, empty means DefaultContentTypes (DefaultSignedContentTypes for signed key sets)
+	AllowedContentTypes []string
+
+	// reject JSON with duplicate object members, trailing data is always rejected
+	StrictJSON bool
+
+	// hold a new key set as pending when it drops more than this fraction (0-1) of the current key ids or is empty
+	// the current keys are served while the new set is pending, 0 disables the check
+	ShrinkThreshold float64
+
+	// accept the pending key set after it was fetched this many more times in a row, 0 means no confirmations
+	ShrinkConfirmations int
+
+	// accept the pending key set after it has been pending this long, 0 means no timeout
+	ShrinkTimeout time.Duration
 }
 
 // NewConfig creates a new Config with default values
@@ -32,13 +71,59 @@ func NewConfig() Config {
 		CacheMax:      time.Hour,
 		CacheErrors:   30 * time.Second,
 		KeepStaleKeys: 5 * time.Minute,
+
+		ConnectTimeout:      5 * time.Second,
+		TLSHandshakeTimeout: 5 * time.Second,
+		RequestTimeout:      30 * time.Second,
+		MaxRedirects:        3,
+		MaxResponseSize:     1 << 20,
+
+		ShrinkConfirmations: 3,
+		ShrinkTimeout:       10 * time.Minute,
 	}
 }
 
+// Validate checks the config, the settings left at zero get their defaults in New
 func (c Config) Validate() error {
 	if c.URL == "" {
 		return errors.New("URL is required")
 	}
 
+	if c.ShrinkThreshold < 0 || c.ShrinkThreshold > 1 {
+		return errors.New("ShrinkThreshold must be between 0 and 1")
+	}
+
+	if c.ShrinkThreshold > 0 && c.ShrinkConfirmations <= 0 && c.ShrinkTimeout <= 0 {
+		return errors.New("ShrinkThreshold requires ShrinkConfirmations or ShrinkTimeout, otherwise pending key sets are never accepted")
+	}
+
 	return nil
 }
+
+// withDefaults returns a copy of the config with the http client settings left at zero set to the defaults,
+// so a Config created as a struct literal gets the same timeouts and limits as NewConfig
+func (c Config) withDefaults() Config {
+	defaults := NewConfig()
+
+	if c.ConnectTimeout == 0 {
+		c.ConnectTimeout = defaults.ConnectTimeout
+	}
+
+	if c.TLSHandshakeTimeout == 0 {
+		c.TLSHandshakeTimeout = defaults.TLSHandshakeTimeout
+	}
+
+	if c.RequestTimeout == 0 {
+		c.RequestTimeout = defaults.RequestTimeout
+	}
+
+	if c.MaxRedirects == 0 {
+		c.MaxRedirects = defaults.MaxRedirects
+	}
+
+	if c.MaxResponseSize == 0 {
+		c.MaxResponseSize = defaults.MaxResponseSize
+	}
+
+	return c
+}
@@ -0,0 +1,228 @@
+package jwksclient
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+/*
+	DebugHandler is an http.Handler meant for admin ports, it exposes the state of one or more clients.
+
+	GET renders the Status(), the cached JWKS and the response headers of the clients as HTML,
+	or as JSON when the request has format=json or accepts application/json.
+	The client query parameter limits the output to one client.
+
+	POST with the client parameter forces Refresh(true) on that client, it is allowed only
+	when the configured Authorizer accepts the request. Without an Authorizer every POST is refused.
+*/
+
+// Authorizer decides whether the request is allowed to perform an action
+type Authorizer func(r *http.Request) bool
+
+type DebugHandlerOption func(*DebugHandler)
+
+// WithDebugAuthorizer sets the authorizer that guards the forced refresh
+func WithDebugAuthorizer(a Authorizer) DebugHandlerOption {
+	return func(h *DebugHandler) {
+		h.authorizer = a
+	}
+}
+
+type DebugHandler struct {
+	clients    map[string]*Client
+	names      []string
+	authorizer Authorizer
+}
+
+// ClientDebugInfo is the state of a single client as rendered by DebugHandler
+type ClientDebugInfo struct {
+	Name    string          `json:"name"`
+	Status  Status          `json:"status"`
+	KeySet  json.RawMessage `json:"keySet,omitempty"`
+	Headers http.Header     `json:"headers,omitempty"`
+}
+
+// NewDebugHandler creates a debug handler for the clients, the map keys are the names shown in the output
+func NewDebugHandler(clients map[string]*Client, opts ...DebugHandlerOption) *DebugHandler {
+	h := &DebugHandler{
+		clients: make(map[string]*Client, len(clients)),
+		names:   make([]string, 0, len(clients)),
+	}
+
+	for name, c := range clients {
+		h.clients[name] = c
+		h.names = append(h.names, name)
+	}
+
+	sort.Strings(h.names)
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+func (h *DebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.serveStatus(w, r)
+
+	case http.MethodPost:
+		h.serveRefresh(w, r)
+
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *DebugHandler) serveStatus(w http.ResponseWriter, r *http.Request) {
+	names := h.names
+
+	if name := r.FormValue("client"); name != "" {
+		if _, ok := h.clients[name]; !ok {
+			http.Error(w, "unknown client", http.StatusNotFound)
+			return
+		}
+
+		names = []string{name}
+	}
+
+	infos := make([]ClientDebugInfo, 0, len(names))
+
+	for _, name := range names {
+		info, err := h.clientInfo(name)
+		if err != nil {
+			log.Error().Err(err).Str("client", name).Msg("debug handler: failed to render key set")
+			http.Error(w, "failed to render key set", http.StatusInternalServerError)
+			return
+		}
+
+		infos = append(infos, info)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(infos); err != nil {
+			log.Error().Err(err).Msg("debug handler: failed to write JSON")
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := debugTemplate.Execute(w, infos); err != nil {
+		log.Error().Err(err).Msg("debug handler: failed to write HTML")
+	}
+}
+
+func (h *DebugHandler) serveRefresh(w http.ResponseWriter, r *http.Request) {
+	if h.authorizer == nil || !h.authorizer(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	name := r.FormValue("client")
+
+	c, ok := h.clients[name]
+	if !ok {
+		http.Error(w, "unknown client", http.StatusNotFound)
+		return
+	}
+
+	refreshed, err := c.Refresh(true)
+
+	log.Info().Err(err).Str("client", name).Msg("debug handler: forced refresh")
+
+	// same as the auto refresh, the callback sees the keys of a forced refresh too
+	if refreshed && c.rcb != nil {
+		ks, err := c.keySet()
+		c.rcb(ks, err)
+	}
+
+	if wantsJSON(r) {
+		h.serveStatus(w, r)
+		return
+	}
+
+	// back to the page of the refreshed client, relative so it works behind http.StripPrefix
+	w.Header().Set("Location", "?client="+url.QueryEscape(name))
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+func (h *DebugHandler) clientInfo(name string) (ClientDebugInfo, error) {
+	c := h.clients[name]
+
+	// status, keys and headers come from one snapshot so they can't disagree after a concurrent refresh
+	c.m.RLock()
+	st := c.status()
+	ks := c.cachedJWKSet
+	headers := c.cachedHeaders.Clone()
+	c.m.RUnlock()
+
+	info := ClientDebugInfo{
+		Name:    name,
+		Status:  st,
+		Headers: headers,
+	}
+
+	if ks != nil {
+		buf, err := json.MarshalIndent(ks, "", "  ")
+		if err != nil {
+			return info, err
+		}
+
+		info.KeySet = buf
+	}
+
+	return info, nil
+}
+
+func wantsJSON(r *http.Request) bool {
+	return r.FormValue("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+var debugTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head><title>JWKS clients</title></head>
+<body>
+{{range .}}
+<h2>{{.Name}}</h2>
+<table>
+<tr><th align="left">URL</th><td>{{.Status.URL}}</td></tr>
+<tr><th align="left">Last attempt</th><td>{{.Status.LastAttempt}}</td></tr>
+<tr><th align="left">Last success</th><td>{{.Status.LastSuccess}}</td></tr>
+<tr><th align="left">Next refresh</th><td>{{.Status.NextRefresh}}</td></tr>
+<tr><th align="left">Last error</th><td>{{.Status.LastErrorMessage}}</td></tr>
+<tr><th align="left">Keys stale since</th><td>{{if not .Status.KeysStaleSince.IsZero}}{{.Status.KeysStaleSince}}{{end}}</td></tr>
+<tr><th align="left">Serving stale keys</th><td>{{.Status.ServingStaleKeys}}</td></tr>
+<tr><th align="left">HTTP status</th><td>{{.Status.HTTPStatus}}</td></tr>
+<tr><th align="left">Cache decision</th><td>{{.Status.CacheDecision}}</td></tr>
+<tr><th align="left">Keys ({{.Status.KeyCount}})</th><td>{{range .Status.KeyIDs}}{{.}}<br>{{end}}</td></tr>
+<tr><th align="left">Pending keys</th><td>{{with .Status.PendingKeySet}}{{range .KeyIDs}}{{.}}<br>{{end}}since {{.Since}}, {{.Confirmations}} confirmations: {{.Reason}}{{end}}</td></tr>
+<tr><th align="left">Shrink decision</th><td>{{.Status.ShrinkDecision}}</td></tr>
+{{with .Status.Shadow}}<tr><th align="left">Shadow</th><td>{{.URL}}: {{.Comparisons}} comparisons, {{.Mismatches}} mismatches, {{.Errors}} errors{{with .LastDiff}}, last: only primary {{.OnlyPrimary}}, only shadow {{.OnlyShadow}}, thumbprint mismatch {{.ThumbprintMismatch}} {{.ErrMessage}}{{end}}</td></tr>{{end}}
+<tr><th align="left">Rejected keys</th><td>{{range $k, $v := .Status.RejectedKeys}}{{$k}}: {{$v}}<br>{{end}}</td></tr>
+</table>
+<form method="post"><input type="hidden" name="client" value="{{.Name}}"><button type="submit">Force refresh</button></form>
+<h3>Response headers</h3>
+<pre>{{range $k, $v := .Headers}}{{$k}}: {{range $v}}{{.}} {{end}}
+{{end}}</pre>
+<h3>Cached JWKS</h3>
+<pre>{{printf "%s" .KeySet}}</pre>
+{{end}}
+</body>
+</html>
+`))
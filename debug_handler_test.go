@@ -0,0 +1,87 @@
+package jwksclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+func TestDebugHandlerForcedRefresh(t *testing.T) {
+	var requests int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Write(mkJWKS("k1"))
+			return
+		}
+
+		w.Write(mkJWKS("k1", "k2"))
+	}))
+	defer srv.Close()
+
+	var callbacks int32
+	var lastLen int32
+
+	cfg := NewConfig()
+	cfg.URL = srv.URL
+
+	c, err := New(cfg, WithWaitFirstFetch(), WithAutoRefreshCallback(func(ks jwk.Set, err error) {
+		atomic.AddInt32(&callbacks, 1)
+
+		if ks != nil {
+			atomic.StoreInt32(&lastLen, int32(ks.Len()))
+		}
+	}))
+	if err != nil {
+		t.Fatal("New() error:", err)
+	}
+
+	if got := atomic.LoadInt32(&callbacks); got != 1 {
+		t.Fatalf("got %d callbacks after the first fetch, want 1", got)
+	}
+
+	h := NewDebugHandler(map[string]*Client{"idp": c}, WithDebugAuthorizer(func(r *http.Request) bool { return true }))
+
+	form := url.Values{"client": {"idp"}, "format": {"json"}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if got := atomic.LoadInt32(&callbacks); got != 2 {
+		t.Errorf("got %d callbacks after the forced refresh, want 2", got)
+	}
+
+	if got := atomic.LoadInt32(&lastLen); got != 2 {
+		t.Errorf("callback got %d keys, want 2", got)
+	}
+
+	var infos []ClientDebugInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+		t.Fatal("decoding the response:", err)
+	}
+
+	if len(infos) != 1 {
+		t.Fatalf("got %d clients, want 1", len(infos))
+	}
+
+	ks, err := jwk.Parse(infos[0].KeySet)
+	if err != nil {
+		t.Fatal("parsing the key set:", err)
+	}
+
+	if infos[0].Status.KeyCount != ks.Len() || ks.Len() != 2 {
+		t.Errorf("status has %d keys, key set has %d, want 2", infos[0].Status.KeyCount, ks.Len())
+	}
+}
@@ -1,7 +1,100 @@
 package jwksclient
 
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// bodyExcerptSize is the maximum size of the body kept in HTTPStatusError
+const bodyExcerptSize = 512
+
 type ErrKeysNotFetched struct{}
 
 func (e *ErrKeysNotFetched) Error() string {
 	return "keys not fetched"
 }
+
+// HTTPStatusError is returned when the JWKS endpoint responds with a status other than 200
+type HTTPStatusError struct {
+	StatusCode int
+	Header     http.Header
+
+	// the beginning of the response body, at most 512 bytes
+	BodyExcerpt []byte
+}
+
+func newHTTPStatusError(statusCode int, header http.Header, body []byte) *HTTPStatusError {
+	if len(body) > bodyExcerptSize {
+		body = body[:bodyExcerptSize]
+	}
+
+	return &HTTPStatusError{
+		StatusCode:  statusCode,
+		Header:      header,
+		BodyExcerpt: append([]byte(nil), body...),
+	}
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status code: %d", e.StatusCode)
+}
+
+// TransportError is returned when the key set could not be retrieved, e.g. connection errors and timeouts
+type TransportError struct {
+	// the failed operation, e.g. "performing request"
+	Op  string
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// ParseError is returned when the response can not be parsed as a key set
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return "parsing key set: " + e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// PolicyError is returned when the response was rejected by a configured policy
+// e.g. Content-Type, size limit, SPKI pins or the signature of a signed key set
+type PolicyError struct {
+	Err error
+}
+
+func (e *PolicyError) Error() string {
+	return "policy violation: " + e.Err.Error()
+}
+
+func (e *PolicyError) Unwrap() error {
+	return e.Err
+}
+
+// StaleKeysExpiredError is returned by GetKeySet when refreshing fails for longer than KeepStaleKeys
+type StaleKeysExpiredError struct {
+	// when the first refresh failed
+	KeysStaleSince time.Time
+
+	// the error of the last refresh
+	Err error
+}
+
+func (e *StaleKeysExpiredError) Error() string {
+	return fmt.Sprintf("stale keys expired, refresh failing since %s: %s", e.KeysStaleSince.Format(time.RFC3339), e.Err)
+}
+
+func (e *StaleKeysExpiredError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,159 @@
+package jwksclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorClassification(t *testing.T) {
+	errMutator := errors.New("mutator failed")
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		config  func(*Config)
+		opts    []Option
+		check   func(t *testing.T, err error)
+	}{
+		{
+			name: "oversized error response is a status error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(strings.Repeat("x", 4096)))
+			},
+			config: func(cfg *Config) { cfg.MaxResponseSize = 1024 },
+			check: func(t *testing.T, err error) {
+				var statusErr *HTTPStatusError
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+					t.Errorf("got %v, want HTTPStatusError 503", err)
+				}
+
+				var policyErr *PolicyError
+				if errors.As(err, &policyErr) {
+					t.Errorf("got %v, want no PolicyError", err)
+				}
+
+				if len(statusErr.BodyExcerpt) != bodyExcerptSize {
+					t.Errorf("got a body excerpt of %d bytes, want %d", len(statusErr.BodyExcerpt), bodyExcerptSize)
+				}
+			},
+		},
+		{
+			name: "oversized key set is a policy error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write(mkJWKS("k1", "k2", "k3"))
+			},
+			config: func(cfg *Config) { cfg.MaxResponseSize = 16 },
+			check: func(t *testing.T, err error) {
+				var tooLarge *ResponseTooLargeError
+				var policyErr *PolicyError
+				if !errors.As(err, &policyErr) || !errors.As(err, &tooLarge) {
+					t.Errorf("got %v, want PolicyError with ResponseTooLargeError", err)
+				}
+			},
+		},
+		{
+			name: "mutator failure is a transport error",
+			opts: []Option{WithRequestMutator(func(req *http.Request) error { return errMutator })},
+			check: func(t *testing.T, err error) {
+				var transportErr *TransportError
+				if !errors.As(err, &transportErr) || transportErr.Op != "mutating request" || !errors.Is(err, errMutator) {
+					t.Errorf("got %v, want TransportError mutating request wrapping the mutator error", err)
+				}
+			},
+		},
+		{
+			name: "token failure is a transport error",
+			opts: []Option{WithClientCredentials(ClientCredentialsConfig{TokenURL: "http://127.0.0.1:1/token", ClientID: "id"})},
+			check: func(t *testing.T, err error) {
+				var transportErr *TransportError
+				if !errors.As(err, &transportErr) || transportErr.Op != "getting access token" {
+					t.Errorf("got %v, want TransportError getting access token", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := tt.handler
+			if handler == nil {
+				handler = func(w http.ResponseWriter, r *http.Request) { w.Write(mkJWKS("k1")) }
+			}
+
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+
+			cfg := NewConfig()
+			cfg.URL = srv.URL
+
+			if tt.config != nil {
+				tt.config(&cfg)
+			}
+
+			c, err := New(cfg, tt.opts...)
+			if err != nil {
+				t.Fatal("New() error:", err)
+			}
+
+			_, err = c.Refresh(true)
+			tt.check(t, err)
+
+			if status := c.Status(); status.LastError != err {
+				t.Errorf("Status().LastError = %v, want %v", status.LastError, err)
+			}
+		})
+	}
+}
+
+func TestStaleKeysExpired(t *testing.T) {
+	fail := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-fail:
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write(mkJWKS("k1"))
+		}
+	}))
+	defer srv.Close()
+
+	cfg := NewConfig()
+	cfg.URL = srv.URL
+	cfg.KeepStaleKeys = 50 * time.Millisecond
+
+	c, err := New(cfg, WithWaitFirstFetch())
+	if err != nil {
+		t.Fatal("New() error:", err)
+	}
+
+	close(fail)
+
+	if _, err := c.Refresh(true); err == nil {
+		t.Fatal("Refresh() succeeded, want an error")
+	}
+
+	// the stale keys are served within KeepStaleKeys
+	if _, err := c.GetKeySet(context.Background()); err != nil {
+		t.Fatal("GetKeySet() error:", err)
+	}
+
+	time.Sleep(2 * cfg.KeepStaleKeys)
+
+	_, err = c.GetKeySet(context.Background())
+
+	var expiredErr *StaleKeysExpiredError
+	if !errors.As(err, &expiredErr) {
+		t.Fatalf("GetKeySet() error = %v, want StaleKeysExpiredError", err)
+	}
+
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("GetKeySet() error = %v, want it to wrap HTTPStatusError 500", err)
+	}
+}
@@ -22,6 +22,8 @@ var log = zerolog.New(os.Stderr).
 		TimeFormat: zerolog.TimeFieldFormat,
 	})
 
+var readThrough bool
+
 func makeConfig() jwksclient.Config {
 	cfg := jwksclient.NewConfig()
 	p := private.Config{}
@@ -35,6 +37,17 @@ func makeConfig() jwksclient.Config {
 	flag.DurationVar(&cfg.CacheErrors, "cache-errors", cfg.CacheErrors, "CacheErrors")
 	flag.BoolVar(&cfg.ExitOnError, "exit-on-error", cfg.ExitOnError, "ExitOnError")
 	flag.DurationVar(&cfg.KeepStaleKeys, "keep-stale-keys", cfg.KeepStaleKeys, "KeepStaleKeys")
+	flag.DurationVar(&cfg.ConnectTimeout, "connect-timeout", cfg.ConnectTimeout, "ConnectTimeout")
+	flag.DurationVar(&cfg.TLSHandshakeTimeout, "tls-handshake-timeout", cfg.TLSHandshakeTimeout, "TLSHandshakeTimeout")
+	flag.DurationVar(&cfg.RequestTimeout, "request-timeout", cfg.RequestTimeout, "RequestTimeout")
+	flag.IntVar(&cfg.MaxRedirects, "max-redirects", cfg.MaxRedirects, "MaxRedirects")
+	flag.Int64Var(&cfg.MaxResponseSize, "max-response-size", cfg.MaxResponseSize, "MaxResponseSize")
+	flag.BoolVar(&cfg.CheckContentType, "check-content-type", cfg.CheckContentType, "CheckContentType")
+	flag.BoolVar(&cfg.StrictJSON, "strict-json", cfg.StrictJSON, "StrictJSON")
+	flag.Float64Var(&cfg.ShrinkThreshold, "shrink-threshold", cfg.ShrinkThreshold, "ShrinkThreshold")
+	flag.IntVar(&cfg.ShrinkConfirmations, "shrink-confirmations", cfg.ShrinkConfirmations, "ShrinkConfirmations")
+	flag.DurationVar(&cfg.ShrinkTimeout, "shrink-timeout", cfg.ShrinkTimeout, "ShrinkTimeout")
+	flag.BoolVar(&readThrough, "read-through", false, "fetch the keys on demand from GetKeySet")
 
 	flag.Parse()
 
@@ -48,13 +61,18 @@ func main() {
 
 	log.Debug().Interface("config", cfg).Msg("current config")
 
-	jwksClient, err := jwksclient.New(cfg)
+	var opts []jwksclient.Option
+	if readThrough {
+		opts = append(opts, jwksclient.WithReadThrough())
+	}
+
+	jwksClient, err := jwksclient.New(cfg, opts...)
 	if err != nil {
 		panic(err)
 	}
 
-	// this is expected to fail because refresher is not running yet
-	if _, err := jwksClient.GetKeySet(); err != nil {
+	// this is expected to fail because refresher is not running yet, unless read-through is enabled
+	if _, err := jwksClient.GetKeySet(context.Background()); err != nil {
 		log.Error().Err(err).Msg("get keys without refresher test")
 	}
 
@@ -74,7 +92,7 @@ func main() {
 			return
 
 		case <-tick.C:
-			_, err := jwksClient.GetKeySet()
+			_, err := jwksClient.GetKeySet(context.Background())
 			if err != nil {
 				log.Error().Err(err).Msg("failed to get keys")
 			}
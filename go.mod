@@ -6,6 +6,8 @@ require (
 	github.com/lestrrat-go/jwx v1.2.29
 	github.com/rs/zerolog v1.33.0
 	github.com/twmb/murmur3 v1.1.8
+	golang.org/x/crypto v0.21.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -19,6 +21,5 @@ require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	golang.org/x/crypto v0.21.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
 )
@@ -0,0 +1,67 @@
+package jwksclient
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// newHTTPClient creates the default http client, it is used unless WithHttpClient is specified
+// the timeouts and the redirect limit come from Config, TLS 1.2 is the minimum version
+func newHTTPClient(config Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   nonNegative(config.ConnectTimeout),
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   nonNegative(config.TLSHandshakeTimeout),
+		ResponseHeaderTimeout: nonNegative(config.RequestTimeout),
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+
+	return &http.Client{
+		Transport:     transport,
+		Timeout:       nonNegative(config.RequestTimeout),
+		CheckRedirect: checkRedirect(config.MaxRedirects),
+	}
+}
+
+// checkRedirect limits the number of redirects and refuses downgrades from https to http
+func checkRedirect(maxRedirects int) func(req *http.Request, via []*http.Request) error {
+	if maxRedirects < 0 {
+		maxRedirects = 0
+	}
+
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+
+		if len(via) > 0 && via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme != "https" {
+			return errors.New("refusing redirect from https to " + req.URL.Scheme)
+		}
+
+		return nil
+	}
+}
+
+// nonNegative maps the negative timeouts of Config to 0, which means no timeout for net/http
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+
+	return d
+}
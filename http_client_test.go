@@ -0,0 +1,204 @@
+package jwksclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigDefaults(t *testing.T) {
+	cfg := Config{URL: "https://example.com/jwks", RequestTimeout: -1, MaxRedirects: -1, MaxResponseSize: -1}
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatal("Validate() error:", err)
+	}
+
+	if cfg.ConnectTimeout != 0 {
+		t.Errorf("Validate() changed the config, got ConnectTimeout %s", cfg.ConnectTimeout)
+	}
+
+	got := cfg.withDefaults()
+	defaults := NewConfig()
+
+	if got.ConnectTimeout != defaults.ConnectTimeout || got.TLSHandshakeTimeout != defaults.TLSHandshakeTimeout {
+		t.Errorf("got timeouts %s, %s, want the defaults", got.ConnectTimeout, got.TLSHandshakeTimeout)
+	}
+
+	// negative values are kept, they disable the setting
+	if got.RequestTimeout != -1 || got.MaxRedirects != -1 || got.MaxResponseSize != -1 {
+		t.Errorf("got RequestTimeout %s, MaxRedirects %d and MaxResponseSize %d, want them unchanged", got.RequestTimeout, got.MaxRedirects, got.MaxResponseSize)
+	}
+
+	if hc := newHTTPClient(got); hc.Timeout != 0 {
+		t.Errorf("got http client timeout %s, want none", hc.Timeout)
+	}
+
+	got = Config{URL: "https://example.com/jwks"}.withDefaults()
+
+	if got.MaxRedirects != defaults.MaxRedirects || got.RequestTimeout != 30*time.Second || got.MaxResponseSize != defaults.MaxResponseSize {
+		t.Errorf("got MaxRedirects %d, RequestTimeout %s and MaxResponseSize %d, want the defaults", got.MaxRedirects, got.RequestTimeout, got.MaxResponseSize)
+	}
+}
+
+func TestConfigLiteralResponseLimit(t *testing.T) {
+	// a key set larger than the default limit
+	kids := make([]string, 0, 25000)
+	for i := 0; i < cap(kids); i++ {
+		kids = append(kids, fmt.Sprintf("key-%05d", i))
+	}
+
+	body := mkJWKS(kids...)
+	if int64(len(body)) <= NewConfig().MaxResponseSize {
+		t.Fatalf("the key set has %d bytes, want more than the default limit", len(body))
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "default limit", config: Config{URL: srv.URL}, wantErr: true},
+		{name: "no limit", config: Config{URL: srv.URL, MaxResponseSize: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.config)
+			if err != nil {
+				t.Fatal("New() error:", err)
+			}
+
+			_, err = c.Refresh(true)
+
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("Refresh() error: %v", err)
+				}
+
+				return
+			}
+
+			var tooLarge *ResponseTooLargeError
+			if !errors.As(err, &tooLarge) || tooLarge.Limit != NewConfig().MaxResponseSize {
+				t.Errorf("Refresh() error = %v, want ResponseTooLargeError with the default limit", err)
+			}
+		})
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxRedirects int
+		via          []string
+		target       string
+		wantErr      string
+	}{
+		{
+			name:         "within the limit",
+			maxRedirects: 2,
+			via:          []string{"https://a/", "https://b/"},
+			target:       "https://c/",
+		},
+		{
+			name:         "over the limit",
+			maxRedirects: 2,
+			via:          []string{"https://a/", "https://b/", "https://c/"},
+			target:       "https://d/",
+			wantErr:      "stopped after 2 redirects",
+		},
+		{
+			name:         "negative limit refuses any redirect",
+			maxRedirects: -1,
+			via:          []string{"https://a/"},
+			target:       "https://b/",
+			wantErr:      "stopped after 0 redirects",
+		},
+		{
+			name:         "https to http downgrade",
+			maxRedirects: 3,
+			via:          []string{"https://a/"},
+			target:       "http://b/",
+			wantErr:      "refusing redirect from https to http",
+		},
+		{
+			name:         "http to https upgrade",
+			maxRedirects: 3,
+			via:          []string{"http://a/"},
+			target:       "https://b/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			via := make([]*http.Request, 0, len(tt.via))
+			for _, u := range tt.via {
+				via = append(via, mkRequest(t, u))
+			}
+
+			err := checkRedirect(tt.maxRedirects)(mkRequest(t, tt.target), via)
+
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("checkRedirect() error: %v", err)
+			}
+
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkRedirect() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadBodyLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int64
+		size    int
+		wantErr bool
+	}{
+		{name: "below the limit", limit: 10, size: 9},
+		{name: "at the limit", limit: 10, size: 10},
+		{name: "over the limit", limit: 10, size: 11, wantErr: true},
+		{name: "no limit", limit: -1, size: 1 << 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{config: Config{MaxResponseSize: tt.limit}}
+
+			body, err := c.readBody(strings.NewReader(strings.Repeat("x", tt.size)))
+
+			if !tt.wantErr {
+				if err != nil || len(body) != tt.size {
+					t.Errorf("readBody() = %d bytes, %v, want %d bytes", len(body), err, tt.size)
+				}
+
+				return
+			}
+
+			var policyErr *PolicyError
+			var tooLarge *ResponseTooLargeError
+			if !errors.As(err, &policyErr) || !errors.As(err, &tooLarge) || tooLarge.Limit != tt.limit {
+				t.Errorf("readBody() error = %v, want a PolicyError with ResponseTooLargeError", err)
+			}
+		})
+	}
+}
+
+func mkRequest(t *testing.T, rawURL string) *http.Request {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &http.Request{URL: u}
+}
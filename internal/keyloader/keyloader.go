@@ -0,0 +1,133 @@
+// Package keyloader holds the options, config checks and directory watching shared by the private and public keyloaders
+package keyloader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dimovnike/go-jwksclient/keyfiles"
+
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/rs/zerolog"
+)
+
+// Options are the keyloader options common to the private and public packages
+type Options struct {
+	Context         context.Context
+	WaitGroup       *sync.WaitGroup
+	WaitFirstFetch  bool
+	RefreshCallback func(jwk.Set)
+}
+
+// NewOptions returns the options with the background context
+func NewOptions() Options {
+	return Options{
+		Context: context.Background(),
+	}
+}
+
+// DefaultRSAAlgorithm is the alg set on RSA keys without one
+const DefaultRSAAlgorithm = "RS256"
+
+// ValidateRSAAlgorithm checks the configured RSA algorithm, empty is set to DefaultRSAAlgorithm
+func ValidateRSAAlgorithm(alg *string) error {
+	switch *alg {
+	case "":
+		*alg = DefaultRSAAlgorithm
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+	default:
+		return fmt.Errorf("unsupported RSA algorithm: %s", *alg)
+	}
+
+	return nil
+}
+
+// WatchConfig configures Watch
+type WatchConfig struct {
+	Dir         string
+	Interval    time.Duration
+	Policy      keyfiles.FilePolicy
+	FailOnError bool
+	Logger      *zerolog.Logger
+
+	// the wait group of the keyloader, the watcher goroutine is tracked by it,
+	// the caller calls Done for its own Add when Watch returns
+	WaitGroup *sync.WaitGroup
+
+	// a receive calls load without a directory change, e.g. when the validity window of a key opens, optional
+	Reload <-chan struct{}
+}
+
+// Watch watches the directory for changes and calls load on every change and reload request,
+// load is never called concurrently by Watch
+// it returns when ctx is done, load fails or, with FailOnError, the watcher reports an error
+func Watch(ctx context.Context, config WatchConfig, load func() error) error {
+	watcher := keyfiles.NewWatcher()
+	watcher.Policy = config.Policy
+	logger := config.Logger
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg *sync.WaitGroup
+	if config.WaitGroup != nil {
+		wg = config.WaitGroup
+	} else {
+		wg = &sync.WaitGroup{}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := watcher.Watch(ctx, config.Dir, config.Interval)
+		logger.Debug().Err(err).Msg("watcher goroutine exited")
+
+		cancel()
+	}()
+
+	logger.Info().Str("dir", config.Dir).Dur("interval", config.Interval).Msg("started watching directory for changes")
+	defer logger.Info().Msg("stopped watching directory for changes")
+
+	var retErr error
+
+loop:
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				// watcher closes the channel when done
+				break loop
+			}
+
+			if event.Error != nil {
+				if config.FailOnError {
+					retErr = event.Error
+					cancel()
+					break loop
+				}
+
+				logger.Error().Err(event.Error).Msg("watcher event error")
+				continue
+			}
+
+		case <-config.Reload:
+			logger.Info().Msg("key validity changed, loading the keys again")
+		}
+
+		if err := load(); err != nil {
+			retErr = err
+			cancel()
+			break loop
+		}
+	}
+
+	logger.Info().Str("dir", config.Dir).Msg("stopping watching directory for changes ...")
+
+	if config.WaitGroup == nil {
+		wg.Wait()
+	}
+
+	return retErr
+}
@@ -0,0 +1,37 @@
+// Package snapshot holds the helpers shared by the Status snapshots of the client and the keyloaders
+package snapshot
+
+import (
+	"context"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+// KeyIDs returns the key ids of the set in order
+func KeyIDs(ks jwk.Set) []string {
+	if ks == nil {
+		return nil
+	}
+
+	kids := make([]string, 0, ks.Len())
+
+	for it := ks.Iterate(context.Background()); it.Next(context.Background()); {
+		kids = append(kids, it.Pair().Value.(jwk.Key).KeyID())
+	}
+
+	return kids
+}
+
+// CopyMap returns a copy of the map, nil stays nil
+func CopyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+
+	return c
+}
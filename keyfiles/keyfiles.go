@@ -54,10 +54,64 @@ func (f FileMetadatas) Hash() ([]byte, error) {
 	return hash.Sum(nil), nil
 }
 
+// SidecarExtensions are the extensions of the metadata files next to the key files
+var SidecarExtensions = []string{".json", ".yaml", ".yml"}
+
+// SplitSidecars separates the sidecar metadata files from the key files
+// a file is a sidecar if its name is the name of another file plus one of SidecarExtensions,
+// so a JWK file key.json is a key file unless a file named key exists
+// it returns the key files and the sidecar file names by key file name, a key file can have one sidecar only
+func (f FileMetadatas) SplitSidecars() (FileMetadatas, map[string]string, error) {
+	names := make(map[string]bool, len(f))
+	for _, m := range f {
+		names[m.Name] = true
+	}
+
+	keys := make(FileMetadatas, 0, len(f))
+	sidecars := map[string]string{}
+
+	for _, m := range f {
+		if keyFile, ok := sidecarOf(m.Name, names); ok {
+			if other, ok := sidecars[keyFile]; ok {
+				return nil, nil, fmt.Errorf("key file %s has several sidecars: %s, %s", keyFile, other, m.Name)
+			}
+
+			sidecars[keyFile] = m.Name
+			continue
+		}
+
+		keys = append(keys, m)
+	}
+
+	return keys, sidecars, nil
+}
+
+// sidecarOf returns the key file of a sidecar file name
+func sidecarOf(name string, names map[string]bool) (string, bool) {
+	for _, ext := range SidecarExtensions {
+		if !strings.HasSuffix(strings.ToLower(name), ext) {
+			continue
+		}
+
+		keyFile := name[:len(name)-len(ext)]
+		if names[keyFile] {
+			return keyFile, true
+		}
+	}
+
+	return "", false
+}
+
 // GetFileMetadata returns the metadata of all files in a directory
 // it skips directories, hidden and ignored files
 // if a symlink is encountered, the metadata of the target is returned
 func GetFileMetadata(dir string) (FileMetadatas, map[string]string, error) {
+	return GetFileMetadataWithPolicy(dir, FilePolicy{})
+}
+
+// GetFileMetadataWithPolicy is GetFileMetadata that also skips the files violating the policy,
+// with a strict policy a violation returns a PolicyViolationError
+func GetFileMetadataWithPolicy(dir string, policy FilePolicy) (FileMetadatas, map[string]string, error) {
 	dirEntries, err := os.ReadDir(dir)
 	if err != nil {
 		return nil, nil, fmt.Errorf("read dir: %w", err)
@@ -78,6 +132,15 @@ func GetFileMetadata(dir string) (FileMetadatas, map[string]string, error) {
 			continue
 		}
 
+		if reason := policy.check(info, len(files)); reason != "" {
+			if policy.Strict {
+				return files, skipped, &PolicyViolationError{File: e.Name(), Reason: reason}
+			}
+
+			skipped[e.Name()] = reason
+			continue
+		}
+
 		files = append(files, FileMetadata{
 			Name:    e.Name(),
 			Size:    info.Size(),
@@ -237,3 +237,176 @@ func checkTmpDir(path string) error {
 
 	return nil
 }
+
+func TestSplitSidecars(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        []string
+		wantKeys     []string
+		wantSidecars map[string]string
+		wantErr      bool
+	}{
+		{
+			name:         "no sidecars",
+			files:        []string{"a", "b.pub"},
+			wantKeys:     []string{"a", "b.pub"},
+			wantSidecars: map[string]string{},
+		},
+		{
+			name:         "json and yaml sidecars",
+			files:        []string{"a", "a.json", "b.pub", "b.pub.yaml", "c.yml"},
+			wantKeys:     []string{"a", "b.pub", "c.yml"},
+			wantSidecars: map[string]string{"a": "a.json", "b.pub": "b.pub.yaml"},
+		},
+		{
+			name:         "JWK file with sidecar",
+			files:        []string{"a.json", "a.json.json"},
+			wantKeys:     []string{"a.json"},
+			wantSidecars: map[string]string{"a.json": "a.json.json"},
+		},
+		{
+			name:    "several sidecars",
+			files:   []string{"a", "a.json", "a.yaml"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := FileMetadatas{}
+			for _, name := range tt.files {
+				files = append(files, FileMetadata{Name: name})
+			}
+
+			keys, sidecars, err := files.SplitSidecars()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SplitSidecars() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			gotKeys := []string{}
+			for _, k := range keys {
+				gotKeys = append(gotKeys, k.Name)
+			}
+
+			if !reflect.DeepEqual(gotKeys, tt.wantKeys) {
+				t.Errorf("SplitSidecars() keys = %v, want %v", gotKeys, tt.wantKeys)
+			}
+
+			if !reflect.DeepEqual(sidecars, tt.wantSidecars) {
+				t.Errorf("SplitSidecars() sidecars = %v, want %v", sidecars, tt.wantSidecars)
+			}
+		})
+	}
+}
+
+func TestGetFileMetadataWithPolicy(t *testing.T) {
+	dir := t.TempDir()
+
+	files := []struct {
+		name    string
+		content string
+		mode    os.FileMode
+	}{
+		{name: "a", content: "key", mode: 0o600},
+		{name: "b", content: "key", mode: 0o644},
+		{name: "c", content: "a larger key", mode: 0o400},
+	}
+
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+
+		if err := os.WriteFile(path, []byte(f.content), f.mode); err != nil {
+			t.Fatal("failed to write file:", err)
+		}
+
+		if err := os.Chmod(path, f.mode); err != nil {
+			t.Fatal("failed to set the mode:", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		policy      FilePolicy
+		wantFiles   []string
+		wantSkipped []string
+		wantErr     bool
+	}{
+		{
+			name:      "no policy",
+			wantFiles: []string{"a", "b", "c"},
+		},
+		{
+			name:        "owner only",
+			policy:      FilePolicy{OwnerOnly: true},
+			wantFiles:   []string{"a", "c"},
+			wantSkipped: []string{"b"},
+		},
+		{
+			name:    "owner only strict",
+			policy:  FilePolicy{OwnerOnly: true, Strict: true},
+			wantErr: true,
+		},
+		{
+			name:      "allowed owner",
+			policy:    FilePolicy{AllowedUIDs: []int{os.Getuid()}},
+			wantFiles: []string{"a", "b", "c"},
+		},
+		{
+			name:        "unexpected owner",
+			policy:      FilePolicy{AllowedUIDs: []int{os.Getuid() + 1}},
+			wantFiles:   []string{},
+			wantSkipped: []string{"a", "b", "c"},
+		},
+		{
+			name:        "max file size",
+			policy:      FilePolicy{MaxFileSize: 5},
+			wantFiles:   []string{"a", "b"},
+			wantSkipped: []string{"c"},
+		},
+		{
+			name:        "max files",
+			policy:      FilePolicy{MaxFiles: 2},
+			wantFiles:   []string{"a", "b"},
+			wantSkipped: []string{"c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, skipped, err := GetFileMetadataWithPolicy(dir, tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetFileMetadataWithPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				var violation *PolicyViolationError
+				if !errors.As(err, &violation) {
+					t.Errorf("GetFileMetadataWithPolicy() error = %v, want PolicyViolationError", err)
+				}
+
+				return
+			}
+
+			gotFiles := []string{}
+			for _, f := range got {
+				gotFiles = append(gotFiles, f.Name)
+			}
+
+			if tt.wantFiles == nil {
+				tt.wantFiles = []string{}
+			}
+
+			if !reflect.DeepEqual(gotFiles, tt.wantFiles) {
+				t.Errorf("GetFileMetadataWithPolicy() files = %v, want %v", gotFiles, tt.wantFiles)
+			}
+
+			for _, name := range tt.wantSkipped {
+				if _, ok := skipped[name]; !ok {
+					t.Errorf("GetFileMetadataWithPolicy() %s not skipped", name)
+				}
+			}
+		})
+	}
+}
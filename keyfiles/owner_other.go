@@ -0,0 +1,12 @@
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+
+package keyfiles
+
+import "io/fs"
+
+// the file modes do not map to unix permissions, the mode and owner checks are not done
+const fileModesSupported = false
+
+func fileOwner(fs.FileInfo) (int, bool) {
+	return 0, false
+}
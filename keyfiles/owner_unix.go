@@ -0,0 +1,20 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package keyfiles
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+const fileModesSupported = true
+
+// fileOwner returns the UID of the file owner
+func fileOwner(info fs.FileInfo) (int, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	return int(st.Uid), true
+}
@@ -0,0 +1,81 @@
+package keyfiles
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+/*
+	FilePolicy holds optional checks of the files in a key directory.
+	A file violating the policy is skipped with the reason, or fails the whole
+	listing with a PolicyViolationError when Strict is set.
+	The mode and owner checks are done on unix platforms only.
+*/
+
+type FilePolicy struct {
+	// refuse files accessible by the group or others, mode & 0o077 != 0
+	OwnerOnly bool
+
+	// refuse files not owned by one of these UIDs, empty means any owner
+	AllowedUIDs []int
+
+	// refuse the files over this count, in directory order, 0 means no limit
+	MaxFiles int
+
+	// refuse files larger than this, 0 means no limit
+	MaxFileSize int64
+
+	// fail on a violation instead of skipping the file
+	Strict bool
+}
+
+// PolicyViolationError is returned by GetFileMetadataWithPolicy for a violation with a strict policy
+type PolicyViolationError struct {
+	File   string
+	Reason string
+}
+
+func (e *PolicyViolationError) Error() string {
+	return fmt.Sprintf("key file %s violates the file policy: %s", e.File, e.Reason)
+}
+
+// check returns the reason why the file violates the policy, empty if it does not
+// count is the number of files accepted before this one
+func (p *FilePolicy) check(info fs.FileInfo, count int) string {
+	if p.MaxFiles > 0 && count >= p.MaxFiles {
+		return fmt.Sprintf("file count limit %d exceeded", p.MaxFiles)
+	}
+
+	if p.MaxFileSize > 0 && info.Size() > p.MaxFileSize {
+		return fmt.Sprintf("file size %d exceeds the limit %d", info.Size(), p.MaxFileSize)
+	}
+
+	if !fileModesSupported {
+		return ""
+	}
+
+	if p.OwnerOnly && info.Mode().Perm()&0o077 != 0 {
+		return fmt.Sprintf("mode %04o is accessible by group or others", info.Mode().Perm())
+	}
+
+	if len(p.AllowedUIDs) > 0 {
+		uid, ok := fileOwner(info)
+		if !ok {
+			return "file owner unknown"
+		}
+
+		allowed := false
+		for _, a := range p.AllowedUIDs {
+			if uid == a {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return fmt.Sprintf("owned by unexpected uid %d", uid)
+		}
+	}
+
+	return ""
+}
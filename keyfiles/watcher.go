@@ -16,6 +16,9 @@ type WatcherEvent struct {
 type Watcher struct {
 	Events <-chan WatcherEvent
 	events chan<- WatcherEvent
+
+	// the file policy of the directory listing, set it before calling Watch
+	Policy FilePolicy
 }
 
 func NewWatcher() *Watcher {
@@ -43,26 +46,24 @@ func (w *Watcher) Watch(ctx context.Context, dir string, interval time.Duration)
 	oldErrStr := ""
 
 	check := func() {
-		files, skipped, err := GetFileMetadata(dir)
-
-		if err != nil && err.Error() == oldErrStr {
-			// have error, but it's the same as last time
-			return
-		}
+		files, skipped, err := GetFileMetadataWithPolicy(dir, w.Policy)
 
-		hash, err := files.Hash()
-		if err != nil && err.Error() == oldErrStr {
-			// have error, but it's the same as last time
-			return
+		// a listing error, e.g. a violation of a strict policy, is reported as is
+		var hash []byte
+		if err == nil {
+			hash, err = files.Hash()
 		}
 
-		oldErrStr = ""
-
 		if err != nil {
+			if err.Error() == oldErrStr {
+				// have error, but it's the same as last time
+				return
+			}
+
 			oldErrStr = err.Error()
-			oldHash = nil
 		} else {
 			oldErrStr = ""
+
 			if bytes.Equal(hash, oldHash) {
 				// no changes
 				return
@@ -71,10 +72,15 @@ func (w *Watcher) Watch(ctx context.Context, dir string, interval time.Duration)
 
 		oldHash = hash
 
-		w.events <- WatcherEvent{
+		select {
+		case w.events <- WatcherEvent{
 			Files:   files,
 			Skipped: skipped,
 			Error:   err,
+		}:
+
+		case <-ctx.Done():
+			// the receiver may have stopped reading
 		}
 	}
 
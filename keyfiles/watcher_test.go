@@ -0,0 +1,69 @@
+package keyfiles
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherPolicyViolation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "key")
+
+	if err := os.WriteFile(path, []byte("key"), 0o644); err != nil {
+		t.Fatal("failed to write file:", err)
+	}
+
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal("failed to set the mode:", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := NewWatcher()
+	w.Policy = FilePolicy{OwnerOnly: true, Strict: true}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Watch(ctx, dir, 10*time.Millisecond)
+	}()
+
+	select {
+	case event := <-w.Events:
+		var violation *PolicyViolationError
+		if !errors.As(event.Error, &violation) {
+			t.Errorf("event error = %v, want PolicyViolationError", event.Error)
+		}
+
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the event")
+	}
+
+	// the same error is not reported again, the fixed file is
+	if err := os.Chmod(path, 0o600); err != nil {
+		t.Fatal("failed to set the mode:", err)
+	}
+
+	select {
+	case event := <-w.Events:
+		if event.Error != nil || len(event.Files) != 1 {
+			t.Errorf("event = %+v, want the key file and no error", event)
+		}
+
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the event")
+	}
+
+	cancel()
+
+	for range w.Events {
+	}
+
+	if err := <-done; err != nil {
+		t.Error("Watch() error:", err)
+	}
+}
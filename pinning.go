@@ -0,0 +1,159 @@
+package jwksclient
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PinMismatchError is returned by Refresh when the certificate chain of the JWKS host matches none of the pins
+type PinMismatchError struct {
+	Host string
+
+	// the SPKI hashes of the presented chain, base64 encoded
+	Presented []string
+}
+
+func (e *PinMismatchError) Error() string {
+	return fmt.Sprintf("no SPKI pin matches the certificate chain of %s, presented: %s", e.Host, strings.Join(e.Presented, ", "))
+}
+
+// WithPinnedSPKI pins the JWKS host to the SHA-256 hashes of the certificate public keys (SPKI), base64 encoded
+// a connection is accepted if any certificate of the chain matches any pin, so include a backup pin for rotation
+// the pins are checked during the TLS handshake when the transport is a *http.Transport and on every response
+// for an IP address host the handshake check applies to all connections without SNI made by the client
+func WithPinnedSPKI(pins ...string) Option {
+	return func(c *Client) {
+		c.pins = append(c.pins, pins...)
+	}
+}
+
+// SPKIHash returns the base64 encoded SHA-256 hash of the certificate public key, the format used by WithPinnedSPKI
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// spkiPins checks certificate chains against the configured pins
+type spkiPins struct {
+	host string
+	pins map[string]bool
+}
+
+func newSPKIPins(rawURL string, pins []string) (*spkiPins, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing URL: %w", err)
+	}
+
+	if u.Scheme != "https" {
+		return nil, errors.New("SPKI pinning requires a https URL")
+	}
+
+	p := &spkiPins{
+		host: u.Hostname(),
+		pins: make(map[string]bool, len(pins)),
+	}
+
+	for _, pin := range pins {
+		buf, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(buf) != sha256.Size {
+			return nil, fmt.Errorf("invalid SPKI pin %q, expected a base64 encoded SHA-256 hash", pin)
+		}
+
+		p.pins[pin] = true
+	}
+
+	if len(p.pins) == 1 {
+		log.Warn().Msg("only one SPKI pin configured, add a backup pin to allow key rotation")
+	}
+
+	return p, nil
+}
+
+// check verifies that any certificate of the chain matches a pin
+func (p *spkiPins) check(cs *tls.ConnectionState) error {
+	if cs == nil {
+		return &PinMismatchError{Host: p.host}
+	}
+
+	chain := cs.PeerCertificates
+	if len(cs.VerifiedChains) > 0 {
+		chain = cs.VerifiedChains[0]
+	}
+
+	presented := make([]string, 0, len(chain))
+
+	for _, cert := range chain {
+		hash := SPKIHash(cert)
+
+		if p.pins[hash] {
+			return nil
+		}
+
+		presented = append(presented, hash)
+	}
+
+	return &PinMismatchError{Host: p.host, Presented: presented}
+}
+
+// serverName returns the name the TLS connection state reports for the host, empty for IP addresses
+func (p *spkiPins) serverName() string {
+	if net.ParseIP(p.host) != nil {
+		return ""
+	}
+
+	return p.host
+}
+
+// wrapClient returns a copy of the http client that checks the pins during the TLS handshake with the JWKS host
+// if the transport is not a *http.Transport the client is returned as is and only the responses are checked
+func (p *spkiPins) wrapClient(client *http.Client) *http.Client {
+	var transport *http.Transport
+
+	switch t := client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+
+	case *http.Transport:
+		transport = t.Clone()
+
+	default:
+		log.Warn().Msgf("SPKI pins can not be checked during the handshake with transport %T, checking the responses only", t)
+		return client
+	}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+
+	verifyConnection := transport.TLSClientConfig.VerifyConnection
+
+	transport.TLSClientConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		if verifyConnection != nil {
+			if err := verifyConnection(cs); err != nil {
+				return err
+			}
+		}
+
+		// the transport may be used for other hosts, e.g. the token endpoint
+		// no SNI is sent for IP addresses, so with an IP host every connection without SNI is checked
+		if cs.ServerName != p.serverName() {
+			return nil
+		}
+
+		return p.check(&cs)
+	}
+
+	wrapped := *client
+	wrapped.Transport = transport
+
+	return &wrapped
+}
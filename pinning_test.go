@@ -0,0 +1,122 @@
+package jwksclient
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestPinnedSPKI(t *testing.T) {
+	var requests int32
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(mkJWKS("k1"))
+	}))
+	defer srv.Close()
+
+	serverPin := SPKIHash(srv.Certificate())
+
+	otherSum := sha256.Sum256([]byte("other key"))
+	otherPin := base64.StdEncoding.EncodeToString(otherSum[:])
+
+	tests := []struct {
+		name string
+		pins []string
+
+		// wrap the transport so the pins can only be checked on the response
+		customTransport bool
+
+		wantMismatch bool
+
+		// the request reaches the server, false when the handshake is aborted
+		wantServed bool
+	}{
+		{
+			name:       "pin matches",
+			pins:       []string{serverPin},
+			wantServed: true,
+		},
+		{
+			name:         "pin mismatch fails the handshake",
+			pins:         []string{otherPin},
+			wantMismatch: true,
+		},
+		{
+			name:       "backup pin matches",
+			pins:       []string{otherPin, serverPin},
+			wantServed: true,
+		},
+		{
+			name:            "pin mismatch on the response with a custom transport",
+			pins:            []string{otherPin},
+			customTransport: true,
+			wantMismatch:    true,
+			wantServed:      true,
+		},
+		{
+			name:            "pin matches on the response with a custom transport",
+			pins:            []string{serverPin},
+			customTransport: true,
+			wantServed:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpClient := srv.Client()
+
+			if tt.customTransport {
+				transport := httpClient.Transport
+				httpClient = &http.Client{Transport: roundTripperFunc(transport.RoundTrip)}
+			}
+
+			cfg := NewConfig()
+			cfg.URL = srv.URL
+
+			c, err := New(cfg, WithHttpClient(httpClient), WithPinnedSPKI(tt.pins...))
+			if err != nil {
+				t.Fatal("New() error:", err)
+			}
+
+			atomic.StoreInt32(&requests, 0)
+
+			_, err = c.Refresh(true)
+
+			if served := atomic.LoadInt32(&requests) > 0; served != tt.wantServed {
+				t.Errorf("request served = %v, want %v", served, tt.wantServed)
+			}
+
+			if !tt.wantMismatch {
+				if err != nil {
+					t.Errorf("Refresh() error: %v", err)
+				}
+
+				return
+			}
+
+			var pinErr *PinMismatchError
+			if !errors.As(err, &pinErr) {
+				t.Fatalf("Refresh() error = %v, want a PinMismatchError", err)
+			}
+
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) {
+				t.Errorf("Refresh() error = %v, want a PolicyError", err)
+			}
+
+			if len(pinErr.Presented) == 0 || pinErr.Presented[0] != serverPin {
+				t.Errorf("got presented pins %v, want %s first", pinErr.Presented, serverPin)
+			}
+		})
+	}
+}
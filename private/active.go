@@ -0,0 +1,164 @@
+package private
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+/*
+	ActiveSigningKey chooses the key to sign with from the loaded keys.
+	Only keys that can sign (use sig and key_ops sign, when set) and that were published
+	at least PropagationDelay ago are candidates. A key is published at the modification time
+	of its file or at the nbf of its sidecar, whichever is later. The keys from the environment
+	and the config have no publish time, they can only change with a restart and are exempt from the delay.
+	The candidates are ordered by the SigningKeyStrategy and the first one is chosen.
+*/
+
+// SigningKeyStrategy decides which key is the active signing key
+type SigningKeyStrategy string
+
+const (
+	// SigningKeyNewest chooses the key with the newest file modification time
+	SigningKeyNewest SigningKeyStrategy = "newest"
+
+	// SigningKeyMarker chooses the key named in the ActiveKeyFile
+	// while the named key is within the propagation delay the newest other key is chosen
+	SigningKeyMarker SigningKeyStrategy = "marker"
+
+	// SigningKeyActivation chooses the key with the latest nbf from its sidecar,
+	// keys without nbf come after the keys with one, ordered by modification time
+	SigningKeyActivation SigningKeyStrategy = "activation"
+)
+
+// ErrNoActiveSigningKey is returned by ActiveSigningKey when no key can be chosen
+var ErrNoActiveSigningKey = errors.New("no signing key is eligible")
+
+// keyInfo holds the file attributes of a loaded key, used to choose the active signing key
+type keyInfo struct {
+	modTime   time.Time
+	notBefore time.Time
+
+	// the key comes from the environment or the config, see loadNamedKeys
+	named bool
+}
+
+// published returns the time the key became public
+func (ki keyInfo) published() time.Time {
+	if ki.notBefore.After(ki.modTime) {
+		return ki.notBefore
+	}
+
+	return ki.modTime
+}
+
+// ActiveSigningKey returns the key to sign with according to the SigningKeyStrategy config option
+func (kl *Keyloader) ActiveSigningKey() (jwk.Key, error) {
+	kl.m.RLock()
+	defer kl.m.RUnlock()
+
+	if kl.keys == nil {
+		return nil, errors.New("keys not loaded")
+	}
+
+	if kl.config.SigningKeyStrategy == SigningKeyMarker {
+		if _, ok := kl.keys.LookupKeyID(kl.activeKeyID); !ok {
+			return nil, fmt.Errorf("active key %q from %s is not loaded", kl.activeKeyID, kl.config.ActiveKeyFile)
+		}
+	}
+
+	now := time.Now()
+
+	type candidate struct {
+		key  jwk.Key
+		info keyInfo
+	}
+
+	var candidates []candidate
+
+	for i := 0; i < kl.keys.Len(); i++ {
+		key, _ := kl.keys.Get(i)
+
+		if !canSign(key) {
+			continue
+		}
+
+		info := kl.keyInfo[key.KeyID()]
+
+		if published := info.published(); !info.named && now.Sub(published) < kl.config.PropagationDelay {
+			kl.config.Logger.Debug().Str("keyId", key.KeyID()).Time("published", published).Msg("signing key within the propagation delay")
+			continue
+		}
+
+		candidates = append(candidates, candidate{key: key, info: info})
+	}
+
+	if len(candidates) == 0 {
+		return nil, ErrNoActiveSigningKey
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+
+		switch kl.config.SigningKeyStrategy {
+		case SigningKeyMarker:
+			if (a.key.KeyID() == kl.activeKeyID) != (b.key.KeyID() == kl.activeKeyID) {
+				return a.key.KeyID() == kl.activeKeyID
+			}
+
+		case SigningKeyActivation:
+			if !a.info.notBefore.Equal(b.info.notBefore) {
+				return a.info.notBefore.After(b.info.notBefore)
+			}
+		}
+
+		if !a.info.modTime.Equal(b.info.modTime) {
+			return a.info.modTime.After(b.info.modTime)
+		}
+
+		return a.key.KeyID() < b.key.KeyID()
+	})
+
+	return candidates[0].key, nil
+}
+
+// canSign reports whether the use and key_ops of the key allow signing
+func canSign(key jwk.Key) bool {
+	if use := key.KeyUsage(); use != "" && use != string(jwk.ForSignature) {
+		return false
+	}
+
+	ops := key.KeyOps()
+	if len(ops) == 0 {
+		return true
+	}
+
+	for _, op := range ops {
+		if op == jwk.KeyOpSign {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readActiveKeyFile reads the kid of the active signing key from the marker file
+func readActiveKeyFile(dir, name string) (string, error) {
+	buf, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", fmt.Errorf("read active key file: %w", err)
+	}
+
+	kid := strings.TrimSpace(string(buf))
+	if kid == "" {
+		return "", fmt.Errorf("active key file %s is empty", name)
+	}
+
+	return kid, nil
+}
@@ -0,0 +1,208 @@
+package private
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+func TestActiveSigningKey(t *testing.T) {
+	now := time.Now()
+
+	keys := []struct {
+		name    string
+		modTime time.Time
+		sidecar string
+	}{
+		{name: "old", modTime: now.Add(-2 * time.Hour), sidecar: "nbf: " + now.Add(-30*time.Minute).UTC().Format(time.RFC3339) + "\n"},
+		{name: "new", modTime: now.Add(-time.Hour)},
+		{name: "fresh", modTime: now},
+		{name: "encryption", modTime: now.Add(-time.Hour), sidecar: "use: enc\n"},
+	}
+
+	tests := []struct {
+		name     string
+		strategy SigningKeyStrategy
+		marker   string
+		delay    time.Duration
+		want     string
+		wantErr  error
+	}{
+		{name: "newest", strategy: SigningKeyNewest, want: "fresh"},
+		{name: "newest with propagation delay", strategy: SigningKeyNewest, delay: 10 * time.Minute, want: "new"},
+		{name: "newest ignores the marker file", strategy: SigningKeyNewest, marker: "old", want: "fresh"},
+		{name: "activation", strategy: SigningKeyActivation, delay: 10 * time.Minute, want: "old"},
+		{name: "marker", strategy: SigningKeyMarker, marker: "old", delay: 10 * time.Minute, want: "old"},
+		{name: "marker within propagation delay", strategy: SigningKeyMarker, marker: "fresh", delay: 10 * time.Minute, want: "new"},
+		{name: "marker of a missing key", strategy: SigningKeyMarker, marker: "missing", wantErr: errors.New("any")},
+		{name: "all within propagation delay", strategy: SigningKeyNewest, delay: 3 * time.Hour, wantErr: ErrNoActiveSigningKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			for _, k := range keys {
+				writeTestKey(t, dir, k.name, k.modTime)
+
+				if k.sidecar != "" {
+					if err := os.WriteFile(filepath.Join(dir, k.name+".yaml"), []byte(k.sidecar), 0o600); err != nil {
+						t.Fatal("failed to write sidecar:", err)
+					}
+				}
+			}
+
+			if tt.marker != "" {
+				if err := os.WriteFile(filepath.Join(dir, "active"), []byte(tt.marker+"\n"), 0o600); err != nil {
+					t.Fatal("failed to write active key file:", err)
+				}
+			}
+
+			cfg := NewConfig()
+			cfg.Dir = dir
+			cfg.SigningKeyStrategy = tt.strategy
+			cfg.PropagationDelay = tt.delay
+
+			kl := &Keyloader{config: cfg}
+			if err := kl.LoadKeys(); err != nil {
+				t.Fatal("LoadKeys() error:", err)
+			}
+
+			got, err := kl.ActiveSigningKey()
+			if (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("ActiveSigningKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == ErrNoActiveSigningKey && !errors.Is(err, ErrNoActiveSigningKey) {
+				t.Fatalf("ActiveSigningKey() error = %v, want %v", err, ErrNoActiveSigningKey)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got.KeyID() != tt.want {
+				t.Errorf("ActiveSigningKey() kid = %s, want %s", got.KeyID(), tt.want)
+			}
+		})
+	}
+}
+
+func TestActiveSigningKeyNamed(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name string
+
+		// the modification time of the key file, no file when zero
+		fileModTime time.Time
+
+		want string
+	}{
+		{name: "inline key only", want: "inline"},
+		{name: "key file preferred", fileModTime: now.Add(-time.Hour), want: "file"},
+		{name: "key file within propagation delay", fileModTime: now, want: "inline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if err != nil {
+				t.Fatal("failed to generate key:", err)
+			}
+
+			cfg := NewConfig()
+			cfg.Dir = ""
+			cfg.Keys = map[string]string{"inline": string(pkcs8PEM(t, key))}
+			cfg.PropagationDelay = 10 * time.Minute
+
+			if !tt.fileModTime.IsZero() {
+				cfg.Dir = t.TempDir()
+				writeTestKey(t, cfg.Dir, "file", tt.fileModTime)
+			}
+
+			kl := &Keyloader{config: cfg}
+
+			// the choice is the same after a reload, as after a restart
+			for i := 0; i < 2; i++ {
+				if err := kl.LoadKeys(); err != nil {
+					t.Fatal("LoadKeys() error:", err)
+				}
+
+				got, err := kl.ActiveSigningKey()
+				if err != nil {
+					t.Fatal("ActiveSigningKey() error:", err)
+				}
+
+				if got.KeyID() != tt.want {
+					t.Errorf("ActiveSigningKey() kid = %s, want %s", got.KeyID(), tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSignerSignToken(t *testing.T) {
+	dir := t.TempDir()
+	writeTestKey(t, dir, "signing", time.Now().Add(-time.Hour))
+
+	cfg := NewConfig()
+	cfg.Dir = dir
+
+	kl := &Keyloader{config: cfg}
+	if err := kl.LoadKeys(); err != nil {
+		t.Fatal("LoadKeys() error:", err)
+	}
+
+	tok := jwt.New()
+	tok.Set(jwt.SubjectKey, "subject")
+
+	buf, err := NewSigner(kl).SignToken(tok)
+	if err != nil {
+		t.Fatal("SignToken() error:", err)
+	}
+
+	msg, err := jws.Parse(buf)
+	if err != nil {
+		t.Fatal("parsing the token:", err)
+	}
+
+	if kid := msg.Signatures()[0].ProtectedHeaders().KeyID(); kid != "signing" {
+		t.Errorf("SignToken() kid = %q, want signing", kid)
+	}
+
+	keys, _, _ := kl.GetKeys()
+
+	public, err := jwk.PublicSetOf(keys)
+	if err != nil {
+		t.Fatal("public key set:", err)
+	}
+
+	if _, err := jwt.Parse(buf, jwt.WithKeySet(public)); err != nil {
+		t.Errorf("SignToken() token does not verify: %v", err)
+	}
+}
+
+func writeTestKey(t *testing.T, dir, name string, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+
+	path := filepath.Join(dir, name)
+
+	if err := os.WriteFile(path, pkcs8PEM(t, key), 0o600); err != nil {
+		t.Fatal("failed to write key file:", err)
+	}
+
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal("failed to set the modification time:", err)
+	}
+}
@@ -2,21 +2,82 @@ package private
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/dimovnike/go-jwksclient/internal/keyloader"
+	"github.com/dimovnike/go-jwksclient/keyfiles"
+
 	"github.com/rs/zerolog"
 )
 
 type Config struct {
-	// the directory to load the keys from
+	// the directory to load the keys from, can be empty when EnvPrefix or Keys is set
 	Dir string
 
+	// load the keys from the environment variables with this prefix, the rest of the variable name is the key name,
+	// the PassphraseEnv variable is not a key even with this prefix
+	EnvPrefix string
+
+	// the inline keys, key name to PEM or JWK
+	Keys map[string]string
+
 	// set to 0 to disable watching
 	WatchInterval time.Duration
 
 	// fail on error, actually return the error, otherwise just log it
 	FailOnError bool
 
+	// load the valid keys when some key files are bad, the bad files are reported as failed
+	// in the status and through WithReportCallback only, the refresh callback gets the valid keys,
+	// otherwise a bad file fails the whole load
+	PartialLoad bool
+
+	// the load fails when fewer keys are loaded
+	MinValidKeys int
+
+	// the permission, owner, count and size checks of the files in Dir, the zero value checks nothing
+	// a file violating it is skipped, or fails the load with a strict policy
+	FilePolicy keyfiles.FilePolicy
+
+	// the alg set on RSA keys: RS256, RS384, RS512, PS256, PS384 or PS512, empty means RS256
+	RSAAlgorithm string
+
+	// the source of the passphrase of encrypted keys, at most one can be set
+	// a file holding the passphrase, a trailing newline is removed
+	PassphraseFile string
+
+	// an environment variable holding the passphrase
+	PassphraseEnv string
+
+	// a callback returning the passphrase, it is called on every load of an encrypted key
+	Passphrase func() ([]byte, error)
+
+	// the strategy deriving the kid of keys without one, empty means KeyIDFileName
+	KeyIDStrategy KeyIDStrategy
+
+	// the pattern of the kid with KeyIDTemplate, {name} is replaced by the file name without .pub
+	KeyIDPattern string
+
+	// the number of hex digits of the kid with KeyIDSHA256, empty means 16
+	KeyIDLength int
+
+	// fail the load with a KeyIDCollisionError when two keys have the same kid,
+	// otherwise a warning is logged and both keys are kept
+	FailOnKeyIDCollision bool
+
+	// the strategy choosing the key returned by ActiveSigningKey, empty means SigningKeyNewest
+	SigningKeyStrategy SigningKeyStrategy
+
+	// the file in Dir holding the kid of the active signing key with SigningKeyMarker,
+	// it is never loaded as a key whatever the strategy
+	ActiveKeyFile string
+
+	// a key published for less than this is never chosen as the active signing key,
+	// it gives the verifiers time to fetch the new key
+	PropagationDelay time.Duration
+
 	// logger
 	Logger *zerolog.Logger
 }
@@ -27,15 +88,76 @@ func NewConfig() Config {
 		Dir:           "./keys",
 		WatchInterval: 1 * time.Second,
 		FailOnError:   false,
+		RSAAlgorithm:  keyloader.DefaultRSAAlgorithm,
+		ActiveKeyFile: "active",
 		Logger:        &zerolog.Logger{},
 	}
 }
 
 func (c *Config) Validate() error {
-	if c.Dir == "" {
+	if c.Dir == "" && c.EnvPrefix == "" && len(c.Keys) == 0 {
 		return errors.New("key-dir is required")
 	}
 
+	if err := keyloader.ValidateRSAAlgorithm(&c.RSAAlgorithm); err != nil {
+		return err
+	}
+
+	switch c.KeyIDStrategy {
+	case "":
+		c.KeyIDStrategy = KeyIDFileName
+	case KeyIDFileName, KeyIDThumbprint:
+	case KeyIDSHA256:
+		if c.KeyIDLength == 0 {
+			c.KeyIDLength = 16
+		}
+
+		if c.KeyIDLength < 8 || c.KeyIDLength > 64 {
+			return fmt.Errorf("key-id-length must be between 8 and 64, got %d", c.KeyIDLength)
+		}
+	case KeyIDTemplate:
+		if !strings.Contains(c.KeyIDPattern, "{name}") {
+			return errors.New("key-id-pattern must contain {name}")
+		}
+	default:
+		return fmt.Errorf("unsupported key id strategy: %s", c.KeyIDStrategy)
+	}
+
+	switch c.SigningKeyStrategy {
+	case "":
+		c.SigningKeyStrategy = SigningKeyNewest
+	case SigningKeyNewest, SigningKeyActivation:
+	case SigningKeyMarker:
+		if c.ActiveKeyFile == "" || c.Dir == "" {
+			return errors.New("key-dir and active-key-file are required with the marker signing key strategy")
+		}
+	default:
+		return fmt.Errorf("unsupported signing key strategy: %s", c.SigningKeyStrategy)
+	}
+
+	if c.MinValidKeys < 0 {
+		return errors.New("min-valid-keys must not be negative")
+	}
+
+	if c.FilePolicy.MaxFiles < 0 || c.FilePolicy.MaxFileSize < 0 {
+		return errors.New("file policy limits must not be negative")
+	}
+
+	if c.PropagationDelay < 0 {
+		return errors.New("propagation-delay must not be negative")
+	}
+
+	sources := 0
+	for _, set := range []bool{c.PassphraseFile != "", c.PassphraseEnv != "", c.Passphrase != nil} {
+		if set {
+			sources++
+		}
+	}
+
+	if sources > 1 {
+		return errors.New("only one of PassphraseFile, PassphraseEnv and Passphrase can be set")
+	}
+
 	return nil
 }
 
@@ -0,0 +1,226 @@
+package private
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+/*
+	Encrypted keys are PKCS#8 PEM blocks of type ENCRYPTED PRIVATE KEY (RFC 5958),
+	encrypted with PBES2 (RFC 8018) using PBKDF2 and AES-CBC, as written by
+	openssl pkcs8 -topk8 -v2 aes-256-cbc and openssl genpkey -aes256.
+	Encrypted OpenSSH keys are supported as well.
+	The passphrase is read from the source set in the config every time a key is loaded,
+	so it can be rotated together with the keys.
+*/
+
+// ErrNoPassphrase is returned when an encrypted key is loaded and no passphrase source is configured
+var ErrNoPassphrase = errors.New("encrypted private key but no passphrase source configured")
+
+// ErrWrongPassphrase is returned when an encrypted key can not be decrypted with the passphrase
+var ErrWrongPassphrase = errors.New("decrypt private key: wrong passphrase or corrupted key")
+
+// ErrIterationCount is returned when the PBKDF2 iteration count of an encrypted key is not between 1 and maxPBKDF2Iterations
+var ErrIterationCount = errors.New("PBKDF2 iteration count out of range")
+
+// maxPBKDF2Iterations bounds the work a crafted key file can cause, openssl uses 2048 and current guidance is below 1 million
+const maxPBKDF2Iterations = 10_000_000
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// passphrase returns the passphrase from the configured source
+func (kl *Keyloader) passphrase() ([]byte, error) {
+	switch {
+	case kl.config.PassphraseFile != "":
+		buf, err := os.ReadFile(kl.config.PassphraseFile)
+		if err != nil {
+			return nil, fmt.Errorf("read passphrase file: %w", err)
+		}
+
+		return bytes.TrimRight(buf, "\r\n"), nil
+
+	case kl.config.PassphraseEnv != "":
+		passphrase, ok := os.LookupEnv(kl.config.PassphraseEnv)
+		if !ok {
+			return nil, fmt.Errorf("passphrase environment variable %s is not set", kl.config.PassphraseEnv)
+		}
+
+		return []byte(passphrase), nil
+
+	case kl.config.Passphrase != nil:
+		passphrase, err := kl.config.Passphrase()
+		if err != nil {
+			return nil, fmt.Errorf("passphrase callback: %w", err)
+		}
+
+		return passphrase, nil
+	}
+
+	return nil, ErrNoPassphrase
+}
+
+// decryptPKCS8 decrypts an EncryptedPrivateKeyInfo and returns the PKCS#8 DER of the key
+func (kl *Keyloader) decryptPKCS8(der []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("parse encrypted PKCS#8 private key: %w", err)
+	}
+
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported encryption scheme %s, only PBES2 is supported", info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("parse PBES2 parameters: %w", err)
+	}
+
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s, only PBKDF2 is supported", params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("parse PBKDF2 parameters: %w", err)
+	}
+
+	if kdf.IterationCount < 1 || kdf.IterationCount > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("%w: %d, the maximum is %d", ErrIterationCount, kdf.IterationCount, maxPBKDF2Iterations)
+	}
+
+	prf, err := pbkdf2PRF(kdf.PRF.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	keyLen, err := aesCBCKeyLength(params.EncryptionScheme.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if kdf.KeyLength != 0 && kdf.KeyLength != keyLen {
+		return nil, fmt.Errorf("PBKDF2 key length %d does not match the cipher", kdf.KeyLength)
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("parse AES-CBC IV: %w", err)
+	}
+
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid AES-CBC IV length %d", len(iv))
+	}
+
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, errors.New("encrypted data is not a multiple of the AES block size")
+	}
+
+	passphrase, err := kl.passphrase()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key(passphrase, kdf.Salt, kdf.IterationCount, keyLen, prf))
+	if err != nil {
+		return nil, err
+	}
+
+	plain := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, info.EncryptedData)
+
+	plain, err = unpadPKCS7(plain)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	return plain, nil
+}
+
+// pbkdf2PRF returns the hash of the PBKDF2 pseudorandom function, the default is HMAC-SHA1
+func pbkdf2PRF(oid asn1.ObjectIdentifier) (func() hash.Hash, error) {
+	switch {
+	case len(oid) == 0, oid.Equal(oidHMACWithSHA1):
+		return sha1.New, nil
+	case oid.Equal(oidHMACWithSHA224):
+		return sha256.New224, nil
+	case oid.Equal(oidHMACWithSHA256):
+		return sha256.New, nil
+	case oid.Equal(oidHMACWithSHA384):
+		return sha512.New384, nil
+	case oid.Equal(oidHMACWithSHA512):
+		return sha512.New, nil
+	}
+
+	return nil, fmt.Errorf("unsupported PBKDF2 pseudorandom function %s", oid)
+}
+
+// aesCBCKeyLength returns the key length of the AES-CBC cipher
+func aesCBCKeyLength(oid asn1.ObjectIdentifier) (int, error) {
+	switch {
+	case oid.Equal(oidAES128CBC):
+		return 16, nil
+	case oid.Equal(oidAES192CBC):
+		return 24, nil
+	case oid.Equal(oidAES256CBC):
+		return 32, nil
+	}
+
+	return 0, fmt.Errorf("unsupported cipher %s, only AES-CBC is supported", oid)
+}
+
+func unpadPKCS7(data []byte) ([]byte, error) {
+	n := int(data[len(data)-1])
+	if n == 0 || n > aes.BlockSize || n > len(data) {
+		return nil, errors.New("invalid padding")
+	}
+
+	for _, b := range data[len(data)-n:] {
+		if int(b) != n {
+			return nil, errors.New("invalid padding")
+		}
+	}
+
+	return data[:len(data)-n], nil
+}
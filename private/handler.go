@@ -0,0 +1,141 @@
+package private
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+/*
+	JWKSHandler serves the public keys of a Keyloader as an RFC 7517 JWKS.
+	The response has a strong ETag derived from its content and honors If-None-Match.
+	The document is rendered again whenever the keyloader reloads the keys.
+*/
+
+type HandlerOption func(*JWKSHandler)
+
+// WithCacheControl sets the Cache-Control header of the responses, default "public, max-age=300"
+func WithCacheControl(cacheControl string) HandlerOption {
+	return func(h *JWKSHandler) {
+		h.cacheControl = cacheControl
+	}
+}
+
+type JWKSHandler struct {
+	kl           *Keyloader
+	cacheControl string
+
+	// the rendered document of the keys loaded at loadTime
+	m        sync.Mutex
+	loadTime time.Time
+	body     []byte
+	etag     string
+}
+
+// NewJWKSHandler creates a handler serving the public keys of the keyloader
+func NewJWKSHandler(kl *Keyloader, opts ...HandlerOption) *JWKSHandler {
+	h := &JWKSHandler{
+		kl:           kl,
+		cacheControl: "public, max-age=300",
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+func (h *JWKSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, etag, err := h.document()
+	if err != nil {
+		h.kl.config.Logger.Error().Err(err).Msg("JWKS handler: failed to render the keys")
+		http.Error(w, "keys not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+
+	if h.cacheControl != "" {
+		w.Header().Set("Cache-Control", h.cacheControl)
+	}
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if _, err := w.Write(body); err != nil {
+		h.kl.config.Logger.Debug().Err(err).Msg("JWKS handler: failed to write the response")
+	}
+}
+
+// document returns the rendered JWKS and its ETag, it is rendered again when the keys were reloaded
+func (h *JWKSHandler) document() ([]byte, string, error) {
+	keys, loadTime, err := h.kl.GetKeys()
+	if err != nil {
+		return nil, "", err
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.body != nil && loadTime.Equal(h.loadTime) {
+		return h.body, h.etag, nil
+	}
+
+	public, err := jwk.PublicSetOf(keys)
+	if err != nil {
+		return nil, "", fmt.Errorf("public key set: %w", err)
+	}
+
+	body, err := json.Marshal(public)
+	if err != nil {
+		return nil, "", fmt.Errorf("marshalling key set: %w", err)
+	}
+
+	sum := sha256.Sum256(body)
+
+	h.body = body
+	h.etag = `"` + base64.RawURLEncoding.EncodeToString(sum[:]) + `"`
+	h.loadTime = loadTime
+
+	return h.body, h.etag, nil
+}
+
+// etagMatches implements the weak comparison of If-None-Match, see RFC 7232 section 3.2
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,207 @@
+package private
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJWKSHandler(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "rsa"), pkcs8PEM(t, rsaKey), 0o600); err != nil {
+		t.Fatal("failed to write key file:", err)
+	}
+
+	writeTestKey(t, dir, "ec", time.Now().Add(-time.Hour))
+
+	cfg := NewConfig()
+	cfg.Dir = dir
+
+	kl := &Keyloader{config: cfg}
+	if err := kl.LoadKeys(); err != nil {
+		t.Fatal("LoadKeys() error:", err)
+	}
+
+	srv := httptest.NewServer(NewJWKSHandler(kl, WithCacheControl("public, max-age=60")))
+	defer srv.Close()
+
+	resp, body := doRequest(t, http.MethodGet, srv.URL, "")
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET status = %d, want 200", resp.StatusCode)
+	}
+
+	etag := resp.Header.Get("ETag")
+	if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) || len(etag) < 3 {
+		t.Errorf("ETag = %q, want a strong ETag", etag)
+	}
+
+	if got := resp.Header.Get("Cache-Control"); got != "public, max-age=60" {
+		t.Errorf("Cache-Control = %q, want the WithCacheControl value", got)
+	}
+
+	if got := resp.Header.Get("Content-Type"); got != "application/jwk-set+json" {
+		t.Errorf("Content-Type = %q, want application/jwk-set+json", got)
+	}
+
+	// only the public members are served
+	keys := parseJWKS(t, body)
+	if len(keys) != 2 {
+		t.Errorf("got %d keys, want 2", len(keys))
+	}
+
+	for _, key := range keys {
+		for _, member := range []string{"d", "p", "q", "dp", "dq", "qi"} {
+			if _, ok := key[member]; ok {
+				t.Errorf("key %v has the private member %s", key["kid"], member)
+			}
+		}
+	}
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{name: "no If-None-Match", wantStatus: http.StatusOK},
+		{name: "same ETag", ifNoneMatch: etag, wantStatus: http.StatusNotModified},
+		{name: "weak ETag", ifNoneMatch: "W/" + etag, wantStatus: http.StatusNotModified},
+		{name: "any", ifNoneMatch: "*", wantStatus: http.StatusNotModified},
+		{name: "list", ifNoneMatch: `"other", ` + etag, wantStatus: http.StatusNotModified},
+		{name: "other ETag", ifNoneMatch: `"other"`, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := doRequest(t, http.MethodGet, srv.URL, tt.ifNoneMatch)
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			if tt.wantStatus == http.StatusNotModified && len(body) != 0 {
+				t.Errorf("got a body of %d bytes with 304", len(body))
+			}
+
+			if got := resp.Header.Get("ETag"); got != etag {
+				t.Errorf("ETag = %q, want %q", got, etag)
+			}
+		})
+	}
+
+	resp, headBody := doRequest(t, http.MethodHead, srv.URL, "")
+
+	if resp.StatusCode != http.StatusOK || len(headBody) != 0 {
+		t.Errorf("HEAD status = %d with %d bytes, want 200 and no body", resp.StatusCode, len(headBody))
+	}
+
+	if resp.ContentLength != int64(len(body)) {
+		t.Errorf("HEAD Content-Length = %d, want %d", resp.ContentLength, len(body))
+	}
+
+	if resp, _ := doRequest(t, http.MethodPost, srv.URL, ""); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want 405", resp.StatusCode)
+	}
+
+	// a new key changes the document and the ETag
+	writeTestKey(t, dir, "new", time.Now())
+
+	if err := kl.LoadKeys(); err != nil {
+		t.Fatal("LoadKeys() error:", err)
+	}
+
+	resp, newBody := doRequest(t, http.MethodGet, srv.URL, etag)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d after the reload, want 200", resp.StatusCode)
+	}
+
+	if resp.Header.Get("ETag") == etag || string(newBody) == string(body) {
+		t.Error("the document and the ETag did not change after the reload")
+	}
+
+	if keys := parseJWKS(t, newBody); len(keys) != 3 {
+		t.Errorf("got %d keys after the reload, want 3", len(keys))
+	}
+}
+
+func TestJWKSHandlerDefaultCacheControl(t *testing.T) {
+	dir := t.TempDir()
+	writeTestKey(t, dir, "ec", time.Now())
+
+	cfg := NewConfig()
+	cfg.Dir = dir
+
+	kl := &Keyloader{config: cfg}
+
+	srv := httptest.NewServer(NewJWKSHandler(kl))
+	defer srv.Close()
+
+	// the keys are not loaded yet
+	if resp, _ := doRequest(t, http.MethodGet, srv.URL, ""); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d before the load, want 503", resp.StatusCode)
+	}
+
+	if err := kl.LoadKeys(); err != nil {
+		t.Fatal("LoadKeys() error:", err)
+	}
+
+	resp, _ := doRequest(t, http.MethodGet, srv.URL, "")
+
+	if got := resp.Header.Get("Cache-Control"); got != "public, max-age=300" {
+		t.Errorf("Cache-Control = %q, want the default", got)
+	}
+}
+
+func doRequest(t *testing.T, method, url, ifNoneMatch string) (*http.Response, []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal("failed to create request:", err)
+	}
+
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("request failed:", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal("failed to read the body:", err)
+	}
+
+	return resp, body
+}
+
+func parseJWKS(t *testing.T, body []byte) []map[string]interface{} {
+	t.Helper()
+
+	var doc struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatal("failed to parse the JWKS:", err)
+	}
+
+	return doc.Keys
+}
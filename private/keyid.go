@@ -0,0 +1,95 @@
+package private
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+/*
+	The kid of a key without one is derived by the KeyIDStrategy.
+	Keys from JWK files keep their kid and a sidecar kid always wins.
+	With KeyIDFileName and KeyIDTemplate a file with several keys numbers them: name-0, name-1, ...
+*/
+
+// KeyIDStrategy decides how the kid of a key is derived
+type KeyIDStrategy string
+
+const (
+	// KeyIDFileName uses the file name without the .pub extension
+	KeyIDFileName KeyIDStrategy = "filename"
+
+	// KeyIDThumbprint uses the base64url RFC 7638 SHA-256 thumbprint of the key,
+	// the same key has the same kid in every environment
+	KeyIDThumbprint KeyIDStrategy = "thumbprint"
+
+	// KeyIDSHA256 uses the first KeyIDLength hex digits of the SHA-256 of the PKIX encoded public key
+	KeyIDSHA256 KeyIDStrategy = "sha256"
+
+	// KeyIDTemplate replaces {name} in KeyIDPattern with the file name without the .pub extension
+	KeyIDTemplate KeyIDStrategy = "template"
+)
+
+// KeyIDCollisionError is returned when two keys have the same kid and FailOnKeyIDCollision is set
+type KeyIDCollisionError struct {
+	KeyID string
+	Files []string
+}
+
+func (e *KeyIDCollisionError) Error() string {
+	return fmt.Sprintf("kid %q is used by several keys: %s", e.KeyID, strings.Join(e.Files, ", "))
+}
+
+// deriveKeyID returns the kid of the key from the file name according to the strategy
+// name is the file name without .pub, index is the position of the key in the file and count the keys in the file
+func (kl *Keyloader) deriveKeyID(key jwk.Key, name string, index, count int) (string, error) {
+	switch kl.config.KeyIDStrategy {
+	case KeyIDThumbprint:
+		public, err := jwk.PublicKeyOf(key)
+		if err != nil {
+			return "", fmt.Errorf("public key: %w", err)
+		}
+
+		tp, err := public.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return "", fmt.Errorf("thumbprint: %w", err)
+		}
+
+		return base64.RawURLEncoding.EncodeToString(tp), nil
+
+	case KeyIDSHA256:
+		public, err := jwk.PublicKeyOf(key)
+		if err != nil {
+			return "", fmt.Errorf("public key: %w", err)
+		}
+
+		var raw interface{}
+		if err := public.Raw(&raw); err != nil {
+			return "", fmt.Errorf("raw public key: %w", err)
+		}
+
+		der, err := x509.MarshalPKIXPublicKey(raw)
+		if err != nil {
+			return "", fmt.Errorf("marshal public key: %w", err)
+		}
+
+		sum := sha256.Sum256(der)
+
+		return hex.EncodeToString(sum[:])[:kl.config.KeyIDLength], nil
+
+	case KeyIDTemplate:
+		name = strings.ReplaceAll(kl.config.KeyIDPattern, "{name}", name)
+	}
+
+	if count > 1 {
+		return fmt.Sprintf("%s-%d", name, index), nil
+	}
+
+	return name, nil
+}
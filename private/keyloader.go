@@ -6,60 +6,105 @@ import (
 	"sync"
 	"time"
 
-	"github.com/dimovnike/go-jwksclient/keyfiles"
+	"github.com/dimovnike/go-jwksclient/internal/keyloader"
 
 	"github.com/lestrrat-go/jwx/jwk"
 )
 
 /*
-	this package watches a directory for changes and loads public keys from files in that directory
-	file names must be the key name and the file content must be the key value
+	this package watches a directory for changes and loads the private signing keys from files in that directory
+	file names must be the key name and the file content must be the key value, see LoadPrivateKeys for the formats
+	the public keys for verification are loaded by the public package
 
-	key Id is derived from the file name, the .pub extension is removed if present
+	key Id is derived from the file name, the .pub extension is removed if present, see KeyIDStrategy for the alternatives
+	a sidecar file <name>.json or <name>.yaml sets the key attributes and validity window, see KeyMetadata
 	to ignore a file, add a .ignore extension
+
+	keys can also come from environment variables and the config, see Config.EnvPrefix and Config.Keys
+
+	ActiveSigningKey chooses the key to sign with, Signer signs JWS and JWT with it
 */
 
 type Option func(*Keyloader)
 type RefreshCallback func(jwk.Set)
+type ReportCallback func(LoadReport)
+
+// LoadReport is the outcome of a load attempt, see WithReportCallback
+type LoadReport struct {
+	// the loaded keys, nil when the load failed and the old keys are kept
+	Keys jwk.Set
+
+	// the loaded (file name to key ids), skipped and failed (file name to reason) files
+	Loaded  map[string]string
+	Skipped map[string]string
+	Failed  map[string]string
+
+	// the error of the load, nil if it succeeded
+	Err error
+}
 
 func WithContext(ctx context.Context) Option {
 	return func(kl *Keyloader) {
-		kl.ctx = ctx
+		kl.opts.Context = ctx
 	}
 }
 
+// WithRefreshCallback sets a callback called with the keys after every successful load,
+// it is not called when a load fails and it does not get the per-file errors, see WithReportCallback
 func WithRefreshCallback(rcb RefreshCallback) Option {
 	return func(kl *Keyloader) {
-		kl.refreshCallback = rcb
+		kl.opts.RefreshCallback = rcb
+	}
+}
+
+// WithReportCallback sets a callback called after every load attempt with the per-file results,
+// with PartialLoad it reports the bad key files that were left out,
+// it is the only callback getting the load errors, the refresh callback only gets the keys
+func WithReportCallback(cb ReportCallback) Option {
+	return func(kl *Keyloader) {
+		kl.reportCallback = cb
 	}
 }
 
 // WithWaitFirstFetch waits for the first fetch to complete before returning from New
 func WithWaitFirstFetch() Option {
 	return func(kl *Keyloader) {
-		kl.waitFirstFetch = true
+		kl.opts.WaitFirstFetch = true
 	}
 }
 
 // WithWaitGroup adds a wait group to the client, it will be done when the auto refresh stops
 func WithWaitGroup(wg *sync.WaitGroup) Option {
 	return func(kl *Keyloader) {
-		kl.wg = wg
+		kl.opts.WaitGroup = wg
 	}
 }
 
 type Keyloader struct {
-	config Config
-
-	ctx             context.Context
-	wg              *sync.WaitGroup
-	waitFirstFetch  bool
-	refreshCallback RefreshCallback
+	config         Config
+	opts           keyloader.Options
+	reportCallback ReportCallback
 
 	// the keys loaded from the directory
 	keys              jwk.Set
 	keysLoadTimestamp time.Time
 
+	// the file attributes of the keys and the kid from the active key file, see ActiveSigningKey
+	keyInfo     map[string]keyInfo
+	activeKeyID string
+
+	// status of the last load attempt
+	lastAttempt time.Time
+	lastError   error
+	loaded      map[string]string
+	skipped     map[string]string
+	failed      map[string]string
+
+	// the reload at the next nbf or exp of a key, the timer signals the watch loop through reload
+	nextReload  time.Time
+	reloadTimer *time.Timer
+	reload      chan struct{}
+
 	// the mutex to protect the keys and keysTimestamp
 	m sync.RWMutex
 }
@@ -71,23 +116,29 @@ func NewKeyloader(config Config, opts ...Option) (*Keyloader, error) {
 
 	kl := &Keyloader{
 		config: config,
-		ctx:    context.Background(),
+		opts:   keyloader.NewOptions(),
+		reload: make(chan struct{}, 1),
 	}
 
 	for _, opt := range opts {
 		opt(kl)
 	}
 
-	if kl.waitFirstFetch {
+	// without a directory the keys come from the environment and the config only, they do not change
+	if kl.opts.WaitFirstFetch || kl.config.Dir == "" {
 		if err := kl.LoadKeys(); err != nil {
 			return nil, err
 		}
 	}
 
-	if kl.wg != nil {
-		kl.wg.Add(1)
+	if kl.config.Dir == "" {
+		return kl, nil
 	}
-	go kl.LoadKeysWatch(kl.ctx)
+
+	if kl.opts.WaitGroup != nil {
+		kl.opts.WaitGroup.Add(1)
+	}
+	go kl.LoadKeysWatch(kl.opts.Context)
 
 	return kl, nil
 }
@@ -111,81 +162,85 @@ func (kl *Keyloader) GetKeys() (jwk.Set, time.Time, error) {
 	return kl.keys, kl.keysLoadTimestamp, nil
 }
 
+// KeySet returns the keys like GetKeys, it matches jwksclient.CompositeMember.KeySet
+func (kl *Keyloader) KeySet(context.Context) (jwk.Set, error) {
+	ks, _, err := kl.GetKeys()
+	return ks, err
+}
+
 // LoadKeysWatch starts watching the directory for changes and loads the keys
 // it honors the FailOnError config option
 func (kl *Keyloader) LoadKeysWatch(ctx context.Context) error {
-	watcher := keyfiles.NewWatcher()
 	logger := kl.config.Logger
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	var wg *sync.WaitGroup
-	if kl.wg != nil {
-		wg = kl.wg
-	} else {
-		wg = &sync.WaitGroup{}
-	}
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		err := watcher.Watch(ctx, kl.config.Dir, kl.config.WatchInterval)
-		logger.Debug().Err(err).Msg("watcher goroutine exited")
-
-		cancel()
-	}()
-
-	logger.Info().Str("dir", kl.config.Dir).Dur("interval", kl.config.WatchInterval).Msg("started watching directory for changes")
-	defer logger.Info().Msg("stopped watching directory for changes")
-
-	var retErr error
-
-	// watcher will close the channel when done
-	for event := range watcher.Events {
-		if event.Error != nil {
-			if kl.config.FailOnError {
-				retErr = event.Error
-				cancel()
-				break
-			}
+	defer func() {
+		// no reload is scheduled once the watching stops
+		kl.m.Lock()
+		kl.scheduleReload(time.Time{})
+		kl.m.Unlock()
 
-			logger.Error().Err(event.Error).Msg("watcher event error")
-			continue
+		if kl.opts.WaitGroup != nil {
+			kl.opts.WaitGroup.Done()
 		}
+	}()
 
+	return keyloader.Watch(ctx, keyloader.WatchConfig{
+		Dir:         kl.config.Dir,
+		Interval:    kl.config.WatchInterval,
+		Policy:      kl.config.FilePolicy,
+		FailOnError: kl.config.FailOnError,
+		Logger:      logger,
+		WaitGroup:   kl.opts.WaitGroup,
+		Reload:      kl.reload,
+	}, func() error {
 		if err := kl.LoadKeys(); err != nil {
-			retErr = err
-			cancel()
-			break
+			return err
 		}
 
-		if kl.refreshCallback != nil {
+		if kl.opts.RefreshCallback != nil {
 			ks, _, err := kl.GetKeys()
 			if err != nil {
 				logger.Error().Err(err).Msg("failed to get keys")
-				continue
+				return nil
 			}
 
-			kl.refreshCallback(ks)
+			kl.opts.RefreshCallback(ks)
 		}
-	}
-
-	logger.Info().Str("dir", kl.config.Dir).Msg("stopping watching directory for changes ...")
 
-	if kl.wg != nil {
-		kl.wg.Done()
-	} else {
-		wg.Wait()
-	}
-
-	return retErr
+		return nil
+	})
 }
 
 // LoadKeysOnce loads the keys once
 // it honors the FailOnError config option
 func (kl *Keyloader) LoadKeys() error {
-	keys, err := kl.loadKeys(kl.config.Dir)
+	res, err := kl.loadKeys(kl.config.Dir)
+
+	kl.m.Lock()
+	kl.lastAttempt = time.Now()
+	kl.lastError = err
+	kl.skipped = res.skipped
+	kl.failed = res.failed
+	if err == nil {
+		kl.loaded = res.loaded
+	}
+	kl.m.Unlock()
+
+	if kl.reportCallback != nil {
+		report := LoadReport{
+			Loaded:  res.loaded,
+			Skipped: res.skipped,
+			Failed:  res.failed,
+			Err:     err,
+		}
+
+		if err == nil {
+			report.Keys = res.keys
+		}
+
+		kl.reportCallback(report)
+	}
+
 	if err != nil {
 		if kl.config.FailOnError {
 			return err
@@ -196,14 +251,43 @@ func (kl *Keyloader) LoadKeys() error {
 	}
 
 	kl.m.Lock()
-	defer kl.m.Unlock()
-
-	kl.keys = keys
+	kl.keys = res.keys
 	kl.keysLoadTimestamp = time.Now()
-
-	if kl.refreshCallback != nil {
-		kl.refreshCallback(keys)
+	kl.keyInfo = res.info
+	kl.activeKeyID = res.activeKeyID
+	kl.scheduleReload(res.nextTransition)
+	kl.m.Unlock()
+
+	// called without the lock, the callback may use the keyloader
+	if kl.opts.RefreshCallback != nil {
+		kl.opts.RefreshCallback(res.keys)
 	}
 
 	return nil
 }
+
+// scheduleReload loads the keys again when the validity window of a key opens or closes
+// the keys are loaded by the watch loop, see LoadKeysWatch, so the loads never overlap
+// it replaces the previous schedule, a zero time cancels it, the lock must be held
+func (kl *Keyloader) scheduleReload(at time.Time) {
+	if kl.reloadTimer != nil {
+		kl.reloadTimer.Stop()
+		kl.reloadTimer = nil
+	}
+
+	kl.nextReload = at
+
+	if at.IsZero() {
+		return
+	}
+
+	reload := kl.reload
+
+	kl.reloadTimer = time.AfterFunc(time.Until(at), func() {
+		select {
+		case reload <- struct{}{}:
+		default:
+			// a reload is already pending
+		}
+	})
+}
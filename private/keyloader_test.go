@@ -0,0 +1,180 @@
+package private
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+func TestScheduledReload(t *testing.T) {
+	ec256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+
+	keyPEM := pkcs8PEM(t, ec256)
+	nbf := time.Now().Add(300 * time.Millisecond)
+
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"current":     string(keyPEM),
+		"later":       string(keyPEM),
+		"later.yaml":  "nbf: " + nbf.Format(time.RFC3339Nano) + "\n",
+		"expires":     string(keyPEM),
+		"expires.yml": "exp: " + time.Now().Add(time.Hour).Format(time.RFC3339) + "\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal("failed to write key file:", err)
+		}
+	}
+
+	cfg := NewConfig()
+	cfg.Dir = dir
+	cfg.WatchInterval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+
+	kl, err := NewKeyloader(cfg, WithContext(ctx), WithWaitGroup(&wg), WithWaitFirstFetch())
+	if err != nil {
+		t.Fatal("NewKeyloader() error:", err)
+	}
+
+	if st := kl.Status(); st.KeyCount != 2 || !st.NextReload.Equal(nbf.Round(0)) {
+		t.Fatalf("got %d keys, next reload %v, want 2 keys and %v", st.KeyCount, st.NextReload, nbf)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for kl.Status().KeyCount != 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("the key was not loaded when its validity window opened")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the watch loop did not stop")
+	}
+
+	kl.m.RLock()
+	defer kl.m.RUnlock()
+
+	if kl.reloadTimer != nil || !kl.nextReload.IsZero() {
+		t.Errorf("reload still scheduled at %v after the watching stopped", kl.nextReload)
+	}
+}
+
+func TestKeySet(t *testing.T) {
+	kl := &Keyloader{config: NewConfig()}
+
+	if _, err := kl.KeySet(context.Background()); err == nil {
+		t.Error("KeySet() succeeded before the keys were loaded, want an error")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+
+	cfg := NewConfig()
+	cfg.Dir = ""
+	cfg.Keys = map[string]string{"inline": string(pkcs8PEM(t, key))}
+
+	kl, err = NewKeyloader(cfg)
+	if err != nil {
+		t.Fatal("NewKeyloader() error:", err)
+	}
+
+	ks, err := kl.KeySet(context.Background())
+	if err != nil {
+		t.Fatal("KeySet() error:", err)
+	}
+
+	if _, ok := ks.LookupKeyID("inline"); !ok || ks.Len() != 1 {
+		t.Errorf("KeySet() got %d keys, want the inline key", ks.Len())
+	}
+}
+
+func TestReportCallback(t *testing.T) {
+	dir := t.TempDir()
+	writeTestKey(t, dir, "a", time.Now())
+
+	if err := os.WriteFile(filepath.Join(dir, "c"), []byte("not a key"), 0o600); err != nil {
+		t.Fatal("failed to write key file:", err)
+	}
+
+	cfg := NewConfig()
+	cfg.Dir = dir
+	cfg.PartialLoad = true
+	cfg.WatchInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	var m sync.Mutex
+	var reports []LoadReport
+	var refreshed []jwk.Set
+
+	_, err := NewKeyloader(cfg,
+		WithContext(ctx),
+		WithWaitGroup(&wg),
+		WithWaitFirstFetch(),
+		WithRefreshCallback(func(ks jwk.Set) {
+			m.Lock()
+			defer m.Unlock()
+			refreshed = append(refreshed, ks)
+		}),
+		WithReportCallback(func(r LoadReport) {
+			m.Lock()
+			defer m.Unlock()
+			reports = append(reports, r)
+		}),
+	)
+	if err != nil {
+		t.Fatal("NewKeyloader() error:", err)
+	}
+
+	cancel()
+	wg.Wait()
+
+	if len(reports) == 0 || len(refreshed) == 0 {
+		t.Fatalf("got %d reports and %d refreshes, want both callbacks called", len(reports), len(refreshed))
+	}
+
+	// the failed file is only in the report, the refresh callback gets the valid keys
+	if _, ok := reports[0].Failed["c"]; !ok || reports[0].Err != nil {
+		t.Errorf("LoadReport = %+v, want c failed and no error", reports[0])
+	}
+
+	if reports[0].Loaded["a"] != "a" {
+		t.Errorf("LoadReport.Loaded = %v, want a", reports[0].Loaded)
+	}
+
+	if refreshed[0].Len() != 1 {
+		t.Errorf("refresh callback got %d keys, want 1", refreshed[0].Len())
+	}
+}
@@ -1,46 +1,101 @@
 package private
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/dimovnike/go-jwksclient/keyfiles"
 
+	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
 )
 
+// LoadPrivateKey loads a PEM encoded private key, see LoadPrivateKeys for the other formats, the key type is detected automatically
+// supported are SEC1 EC keys, PKCS#1 RSA keys and plain or encrypted PKCS#8 EC, RSA and Ed25519 keys
+// the alg of the key is set according to the key type, see defaultAlgorithm
 func (kl *Keyloader) LoadPrivateKey(srcPrivateKey []byte) (jwk.Key, error) {
 	kl.config.Logger.Debug().Msgf("loading jwt private key (%d bytes)", len(srcPrivateKey))
 
-	var err error
-
 	// load private key
 	pkPem, _ := pem.Decode(srcPrivateKey)
 
 	if pkPem == nil {
-		return nil, fmt.Errorf("EC private key not in PEM format")
+		return nil, fmt.Errorf("private key not in PEM format")
 	}
 
-	if pkPem.Type != "EC PRIVATE KEY" {
-		return nil, fmt.Errorf("EC private key PEM wrong format: %s", pkPem.Type)
+	privateKey, err := kl.parsePrivateKeyPEM(pkPem)
+	if err != nil {
+		return nil, err
 	}
 
-	var parsedKey interface{}
+	return kl.newPrivateJWK(privateKey)
+}
 
-	if parsedKey, err = x509.ParseECPrivateKey(pkPem.Bytes); err != nil {
-		return nil, fmt.Errorf("parse EC private key: %w", err)
+// parsePrivateKeyPEM parses the private key according to the PEM block type
+// encrypted PKCS#8 keys are decrypted with the configured passphrase, see decryptPKCS8
+func (kl *Keyloader) parsePrivateKeyPEM(block *pem.Block) (crypto.PrivateKey, error) {
+	if strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+		return nil, errors.New("legacy encrypted PEM is not supported, convert the key to encrypted PKCS#8")
 	}
 
-	var privateKey *ecdsa.PrivateKey
-	var ok bool
-	privateKey, ok = parsedKey.(*ecdsa.PrivateKey)
-	if !ok {
-		return nil, fmt.Errorf("unable to cast EC private key")
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse EC private key: %w", err)
+		}
+
+		return key, nil
+
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse RSA private key: %w", err)
+		}
+
+		return key, nil
+
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse PKCS#8 private key: %w", err)
+		}
+
+		return key, nil
+
+	case "ENCRYPTED PRIVATE KEY":
+		der, err := kl.decryptPKCS8(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("parse decrypted PKCS#8 private key: %w", err)
+		}
+
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unsupported private key PEM type: %s", block.Type)
+}
+
+// newPrivateJWK creates the sign JWK with the default alg for the key type
+func (kl *Keyloader) newPrivateJWK(privateKey crypto.PrivateKey) (jwk.Key, error) {
+	alg, err := kl.defaultAlgorithm(privateKey)
+	if err != nil {
+		return nil, err
 	}
 
 	// create sign JWK
@@ -49,56 +104,291 @@ func (kl *Keyloader) LoadPrivateKey(srcPrivateKey []byte) (jwk.Key, error) {
 		return nil, fmt.Errorf("failed to create sign JWK: %w", err)
 	}
 
+	if err := jwkPrivateKey.Set(jwk.AlgorithmKey, alg); err != nil {
+		return nil, fmt.Errorf("set alg: %w", err)
+	}
+
 	return jwkPrivateKey, nil
 }
 
+// defaultAlgorithm returns the signature algorithm for the key
+// EC keys use ES256, ES384 or ES512 by curve, RSA keys use the RSAAlgorithm config option and Ed25519 keys use EdDSA
+func (kl *Keyloader) defaultAlgorithm(privateKey crypto.PrivateKey) (jwa.SignatureAlgorithm, error) {
+	switch key := privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return jwa.ES256, nil
+		case elliptic.P384():
+			return jwa.ES384, nil
+		case elliptic.P521():
+			return jwa.ES512, nil
+		}
+
+		return "", fmt.Errorf("unsupported EC curve: %s", key.Curve.Params().Name)
+
+	case *rsa.PrivateKey:
+		return jwa.SignatureAlgorithm(kl.config.RSAAlgorithm), nil
+
+	case ed25519.PrivateKey:
+		return jwa.EdDSA, nil
+	}
+
+	return "", fmt.Errorf("unsupported private key type: %T", privateKey)
+}
+
+// LoadPrivateKeyFromFile loads the private key from a file, see LoadPrivateKeys for the supported formats
+// it fails if the file holds more than one key
 func (kl *Keyloader) LoadPrivateKeyFromFile(privateKeyFile string) (jwk.Key, error) {
+	keys, err := kl.LoadPrivateKeysFromFile(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) != 1 {
+		return nil, fmt.Errorf("private key file %s holds %d keys, expected one", privateKeyFile, len(keys))
+	}
+
+	return keys[0], nil
+}
+
+// LoadPrivateKeysFromFile loads all the private keys from a file, see LoadPrivateKeys for the supported formats
+func (kl *Keyloader) LoadPrivateKeysFromFile(privateKeyFile string) ([]jwk.Key, error) {
 	pkBuf, err := os.ReadFile(privateKeyFile)
 	if err != nil {
 		return nil, fmt.Errorf("read private key file %s: %w", privateKeyFile, err)
 	}
 
-	return kl.LoadPrivateKey(pkBuf)
+	return kl.LoadPrivateKeys(pkBuf)
+}
+
+// loadResult is the outcome of loading the keys from the directory
+type loadResult struct {
+	keys jwk.Set
+
+	// the loaded (file name to key id), skipped and failed (file name to reason) files
+	loaded  map[string]string
+	skipped map[string]string
+	failed  map[string]string
+
+	// the next nbf or exp of a key from a sidecar, zero if none, the keys are loaded again then
+	nextTransition time.Time
+
+	// the file attributes by key id and the kid from the active key file
+	info        map[string]keyInfo
+	activeKeyID string
+
+	// the source of each kid, to detect collisions
+	kidSources map[string]string
 }
 
-func (kl *Keyloader) loadKeys(dir string) (jwk.Set, error) {
-	fileMetadata, skipped, err := keyfiles.GetFileMetadata(dir)
+// loadKeys loads the keys from dir, the environment and the config, keys outside of the validity window
+// of their sidecar are skipped, with PartialLoad a bad key file is reported in failed instead of failing the load
+func (kl *Keyloader) loadKeys(dir string) (loadResult, error) {
+	res := loadResult{
+		keys:       jwk.NewSet(),
+		loaded:     map[string]string{},
+		skipped:    map[string]string{},
+		failed:     map[string]string{},
+		info:       map[string]keyInfo{},
+		kidSources: map[string]string{},
+	}
+
+	if dir != "" {
+		if err := kl.loadDirKeys(dir, &res); err != nil {
+			return res, err
+		}
+	}
+
+	if err := kl.loadNamedKeys(&res); err != nil {
+		return res, err
+	}
+
+	if len(res.skipped) > 0 || len(res.failed) > 0 {
+		kl.config.Logger.Info().Interface("skipped", res.skipped).Interface("failed", res.failed).Interface("loaded", res.loaded).Msg("loaded private keys")
+	}
+
+	if n := res.keys.Len(); n < kl.config.MinValidKeys {
+		return res, fmt.Errorf("only %d valid keys loaded, at least %d required", n, kl.config.MinValidKeys)
+	}
+
+	return res, nil
+}
+
+// loadDirKeys loads the key files of dir into res
+func (kl *Keyloader) loadDirKeys(dir string, res *loadResult) error {
+	fileMetadata, skipped, err := keyfiles.GetFileMetadataWithPolicy(dir, kl.config.FilePolicy)
 	if err != nil {
-		return nil, fmt.Errorf("getting file metadata: %w", err)
+		res.skipped = skipped
+		return fmt.Errorf("getting file metadata: %w", err)
 	}
 
-	keySet := jwk.NewSet()
+	res.skipped = skipped
+
+	keyFiles, sidecars, err := fileMetadata.SplitSidecars()
+	if err != nil {
+		return err
+	}
 
-	loaded := map[string]string{}
+	if kl.config.SigningKeyStrategy == SigningKeyMarker {
+		res.activeKeyID, err = readActiveKeyFile(dir, kl.config.ActiveKeyFile)
+		if err != nil {
+			return err
+		}
+	}
 
-	for _, f := range fileMetadata {
-		fullPath := filepath.Join(dir, f.Name)
+	// the marker file is never a key, also when the strategy is switched away from marker
+	if kl.config.ActiveKeyFile != "" {
+		keyFiles = removeFile(keyFiles, kl.config.ActiveKeyFile)
+	}
 
-		key, err := kl.LoadPrivateKeyFromFile(fullPath)
+	now := time.Now()
+
+	for _, f := range keyFiles {
+		// a key must not be loaded without the attributes of its skipped sidecar
+		if sidecar, reason := skippedSidecar(f.Name, res.skipped); sidecar != "" {
+			res.skipped[f.Name] = fmt.Sprintf("sidecar %s skipped: %s", sidecar, reason)
+			continue
+		}
+
+		keys, md, err := kl.loadKeyFile(dir, f.Name, sidecars[f.Name])
 		if err != nil {
-			return nil, fmt.Errorf("loading key from %s: %w", fullPath, err)
+			if !kl.config.PartialLoad {
+				return err
+			}
+
+			kl.config.Logger.Warn().Err(err).Str("filename", f.Name).Msg("failed to load key file")
+			res.failed[f.Name] = err.Error()
+			continue
 		}
 
-		keyId := f.Name
-		if strings.HasSuffix(strings.ToLower(keyId), ".pub") {
-			keyId = keyId[:len(keyId)-4]
+		reason, next := md.validity(now)
+		if !next.IsZero() && (res.nextTransition.IsZero() || next.Before(res.nextTransition)) {
+			res.nextTransition = next
 		}
 
-		key.Set(jwk.KeyIDKey, keyId)
-		key.Set(jwk.KeyUsageKey, jwk.ForSignature)
+		if reason != "" {
+			res.skipped[f.Name] = reason
+			continue
+		}
+
+		info := keyInfo{modTime: f.ModTime}
+		if md != nil && md.NotBefore != nil {
+			info.notBefore = *md.NotBefore
+		}
+
+		if err := kl.addKeys(res, f.Name, keys, info); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addKeys adds the keys loaded from source to res, source is a file name or a named source, see loadNamedKeys
+func (kl *Keyloader) addKeys(res *loadResult, source string, keys []jwk.Key, info keyInfo) error {
+	keyIds := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		keyId := key.KeyID()
+
+		if other, ok := res.kidSources[keyId]; ok {
+			if kl.config.FailOnKeyIDCollision {
+				return &KeyIDCollisionError{KeyID: keyId, Files: []string{other, source}}
+			}
+
+			kl.config.Logger.Warn().Str("filename", source).Str("other", other).Str("keyId", keyId).Msg("key id already loaded")
+		}
+
+		res.kidSources[keyId] = source
+		res.keys.Add(key)
+		res.info[keyId] = info
+
+		keyIds = append(keyIds, keyId)
+	}
+
+	res.loaded[source] = strings.Join(keyIds, ",")
 
-		added := keySet.Add(key)
+	return nil
+}
+
+// loadKeyFile loads the keys of a file and applies its sidecar, the keys have their final kid
+func (kl *Keyloader) loadKeyFile(dir, name, sidecar string) ([]jwk.Key, *KeyMetadata, error) {
+	fullPath := filepath.Join(dir, name)
+
+	keys, err := kl.LoadPrivateKeysFromFile(fullPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading key from %s: %w", fullPath, err)
+	}
+
+	var md *KeyMetadata
+	if sidecar != "" {
+		md, err = loadKeyMetadata(filepath.Join(dir, sidecar))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if md.KeyID != "" && len(keys) > 1 {
+			return nil, nil, fmt.Errorf("sidecar %s sets kid but %s holds %d keys", sidecar, name, len(keys))
+		}
+	}
+
+	baseId := name
+	if strings.HasSuffix(strings.ToLower(baseId), ".pub") {
+		baseId = baseId[:len(baseId)-4]
+	}
+
+	if err := kl.prepareKeys(keys, baseId, md); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
 
-		if !added {
-			kl.config.Logger.Warn().Str("filename", f.Name).Str("keyId", keyId).Msg("key already loaded")
+	return keys, md, nil
+}
+
+// prepareKeys sets the kid, use and the sidecar attributes of the keys loaded from a source named name
+func (kl *Keyloader) prepareKeys(keys []jwk.Key, name string, md *KeyMetadata) error {
+	for i, key := range keys {
+		// keys from JWK files keep their kid, the sidecar kid is applied below
+		if key.KeyID() == "" {
+			keyId, err := kl.deriveKeyID(key, name, i, len(keys))
+			if err != nil {
+				return fmt.Errorf("deriving kid: %w", err)
+			}
+
+			key.Set(jwk.KeyIDKey, keyId)
 		}
 
-		loaded[f.Name] = keyId
+		key.Set(jwk.KeyUsageKey, jwk.ForSignature)
+
+		if md != nil {
+			if err := md.apply(key); err != nil {
+				return fmt.Errorf("applying sidecar: %w", err)
+			}
+		}
 	}
 
-	if len(skipped) > 0 {
-		kl.config.Logger.Info().Interface("skipped", skipped).Interface("loaded", loaded).Msg("loaded private keys")
+	return nil
+}
+
+// skippedSidecar returns the sidecar of the key file and the reason if it was skipped
+func skippedSidecar(name string, skipped map[string]string) (string, string) {
+	for _, ext := range keyfiles.SidecarExtensions {
+		if reason, ok := skipped[name+ext]; ok {
+			return name + ext, reason
+		}
+	}
+
+	return "", ""
+}
+
+func removeFile(files keyfiles.FileMetadatas, name string) keyfiles.FileMetadatas {
+	kept := files[:0:0]
+
+	for _, f := range files {
+		if f.Name != name {
+			kept = append(kept, f)
+		}
 	}
 
-	return keySet, nil
+	return kept
 }
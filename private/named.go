@@ -0,0 +1,89 @@
+package private
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+/*
+	Besides the key directory, keys are loaded from environment variables and from the config,
+	for platforms that inject secrets as variables only:
+	- every variable named EnvPrefix + name, e.g. JWT_KEY_signing=<PEM or JWK>, except PassphraseEnv
+	- every entry of Config.Keys, name to PEM or JWK
+	The name takes the place of the file name in the kid derivation, see KeyIDStrategy.
+	The sources are reported as env:<variable> and inline:<name> in the status and the report callback.
+	These keys have no modification time, the newest strategy prefers any key file over them.
+	They can only change with a restart, so they are exempt from the propagation delay.
+*/
+
+// loadNamedKeys loads the keys from the environment variables and the config into res
+func (kl *Keyloader) loadNamedKeys(res *loadResult) error {
+	type namedKey struct {
+		source string
+		name   string
+		value  string
+	}
+
+	var named []namedKey
+
+	if prefix := kl.config.EnvPrefix; prefix != "" {
+		for _, env := range os.Environ() {
+			variable, value, _ := strings.Cut(env, "=")
+
+			if !strings.HasPrefix(variable, prefix) || len(variable) == len(prefix) {
+				continue
+			}
+
+			// the passphrase variable may share the prefix, e.g. JWT_KEY_PASSPHRASE
+			if variable == kl.config.PassphraseEnv {
+				continue
+			}
+
+			named = append(named, namedKey{source: "env:" + variable, name: variable[len(prefix):], value: value})
+		}
+	}
+
+	for name, value := range kl.config.Keys {
+		named = append(named, namedKey{source: "inline:" + name, name: name, value: value})
+	}
+
+	sort.Slice(named, func(i, j int) bool {
+		return named[i].source < named[j].source
+	})
+
+	for _, n := range named {
+		keys, err := kl.LoadPrivateKeys([]byte(unescapeNewlines(n.value)))
+		if err == nil {
+			err = kl.prepareKeys(keys, n.name, nil)
+		}
+
+		if err != nil {
+			err = fmt.Errorf("loading key from %s: %w", n.source, err)
+
+			if !kl.config.PartialLoad {
+				return err
+			}
+
+			kl.config.Logger.Warn().Err(err).Str("source", n.source).Msg("failed to load key")
+			res.failed[n.source] = err.Error()
+			continue
+		}
+
+		if err := kl.addKeys(res, n.source, keys, keyInfo{named: true}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unescapeNewlines replaces the \n escapes of a single line PEM value, some platforms can not set multi-line variables
+func unescapeNewlines(value string) string {
+	if !strings.HasPrefix(value, "-----BEGIN") || strings.Contains(value, "\n") {
+		return value
+	}
+
+	return strings.ReplaceAll(value, `\n`, "\n")
+}
@@ -0,0 +1,117 @@
+package private
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+	A key file can have a sidecar metadata file next to it, named like the key file
+	plus .json, .yaml or .yml, see keyfiles.SplitSidecars. It sets the attributes of the keys
+	of the key file and their validity window:
+
+		kid: signing-2024
+		alg: ES256
+		use: sig
+		key_ops: [sign]
+		nbf: 2024-01-01T00:00:00Z
+		exp: 2024-07-01T00:00:00Z
+
+	Keys outside of their validity window are not loaded, the keys are loaded again
+	when the next nbf or exp passes. Unknown fields are an error to catch typos.
+*/
+
+// KeyMetadata is the content of a sidecar metadata file, empty fields keep the defaults
+type KeyMetadata struct {
+	KeyID     string     `json:"kid,omitempty" yaml:"kid"`
+	Algorithm string     `json:"alg,omitempty" yaml:"alg"`
+	Use       string     `json:"use,omitempty" yaml:"use"`
+	KeyOps    []string   `json:"key_ops,omitempty" yaml:"key_ops"`
+	NotBefore *time.Time `json:"nbf,omitempty" yaml:"nbf"`
+	Expires   *time.Time `json:"exp,omitempty" yaml:"exp"`
+}
+
+// loadKeyMetadata reads a sidecar file, the format is chosen by the extension
+func loadKeyMetadata(path string) (*KeyMetadata, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read sidecar %s: %w", path, err)
+	}
+
+	md := &KeyMetadata{}
+
+	if strings.HasSuffix(strings.ToLower(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(md)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(buf))
+		dec.KnownFields(true)
+		err = dec.Decode(md)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("parse sidecar %s: %w", path, err)
+	}
+
+	if md.NotBefore != nil && md.Expires != nil && !md.Expires.After(*md.NotBefore) {
+		return nil, fmt.Errorf("sidecar %s: exp is not after nbf", path)
+	}
+
+	return md, nil
+}
+
+// apply sets the attributes of the metadata on the key
+func (md *KeyMetadata) apply(key jwk.Key) error {
+	attrs := []struct {
+		name  string
+		value interface{}
+		set   bool
+	}{
+		{jwk.KeyIDKey, md.KeyID, md.KeyID != ""},
+		{jwk.AlgorithmKey, md.Algorithm, md.Algorithm != ""},
+		{jwk.KeyUsageKey, md.Use, md.Use != ""},
+		{jwk.KeyOpsKey, md.KeyOps, len(md.KeyOps) > 0},
+	}
+
+	for _, attr := range attrs {
+		if !attr.set {
+			continue
+		}
+
+		if err := key.Set(attr.name, attr.value); err != nil {
+			return fmt.Errorf("set %s: %w", attr.name, err)
+		}
+	}
+
+	return nil
+}
+
+// validity checks the validity window at now, it returns the reason when the key is out of it
+// and the next time the validity changes, zero if it never does
+func (md *KeyMetadata) validity(now time.Time) (string, time.Time) {
+	if md == nil {
+		return "", time.Time{}
+	}
+
+	if md.Expires != nil && !now.Before(*md.Expires) {
+		return "expired at " + md.Expires.Format(time.RFC3339), time.Time{}
+	}
+
+	if md.NotBefore != nil && now.Before(*md.NotBefore) {
+		return "not valid before " + md.NotBefore.Format(time.RFC3339), *md.NotBefore
+	}
+
+	if md.Expires != nil {
+		return "", *md.Expires
+	}
+
+	return "", time.Time{}
+}
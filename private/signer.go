@@ -0,0 +1,78 @@
+package private
+
+import (
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+// Signer signs JWS and JWT with the active signing key of a keyloader
+// the alg and kid headers are always taken from the key, see Keyloader.ActiveSigningKey
+type Signer struct {
+	kl *Keyloader
+}
+
+// NewSigner creates a signer using the active signing key of the keyloader
+func NewSigner(kl *Keyloader) *Signer {
+	return &Signer{kl: kl}
+}
+
+// Sign signs the payload as a compact JWS, hdrs can be nil or hold additional protected headers
+func (s *Signer) Sign(payload []byte, hdrs jws.Headers) ([]byte, error) {
+	if hdrs == nil {
+		hdrs = jws.NewHeaders()
+	}
+
+	key, alg, err := s.prepare(hdrs)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := jws.Sign(payload, alg, key, jws.WithHeaders(hdrs))
+	if err != nil {
+		return nil, fmt.Errorf("signing payload with key %s: %w", key.KeyID(), err)
+	}
+
+	return buf, nil
+}
+
+// SignToken signs the token as a compact JWT with typ JWT
+func (s *Signer) SignToken(tok jwt.Token) ([]byte, error) {
+	hdrs := jws.NewHeaders()
+	if err := hdrs.Set(jws.TypeKey, "JWT"); err != nil {
+		return nil, fmt.Errorf("set typ: %w", err)
+	}
+
+	key, alg, err := s.prepare(hdrs)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := jwt.Sign(tok, alg, key, jwt.WithHeaders(hdrs))
+	if err != nil {
+		return nil, fmt.Errorf("signing token with key %s: %w", key.KeyID(), err)
+	}
+
+	return buf, nil
+}
+
+// prepare returns the active signing key and its alg and sets the kid header
+func (s *Signer) prepare(hdrs jws.Headers) (jwk.Key, jwa.SignatureAlgorithm, error) {
+	key, err := s.kl.ActiveSigningKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("active signing key: %w", err)
+	}
+
+	if key.Algorithm() == "" {
+		return nil, "", fmt.Errorf("signing key %s has no alg", key.KeyID())
+	}
+
+	if err := hdrs.Set(jws.KeyIDKey, key.KeyID()); err != nil {
+		return nil, "", fmt.Errorf("set kid: %w", err)
+	}
+
+	return key, jwa.SignatureAlgorithm(key.Algorithm()), nil
+}
@@ -0,0 +1,62 @@
+package private
+
+import (
+	"time"
+
+	"github.com/dimovnike/go-jwksclient/internal/snapshot"
+)
+
+// Status is a snapshot of the keyloader state, see Keyloader.Status
+type Status struct {
+	Dir string `json:"dir"`
+
+	LoadTime    time.Time `json:"loadTime"`
+	LastAttempt time.Time `json:"lastAttempt"`
+
+	// NextReload is the next nbf or exp of a key from a sidecar, zero if none
+	NextReload time.Time `json:"nextReload,omitempty"`
+
+	// LastError is the error of the last load attempt, nil if it succeeded
+	LastError        error  `json:"-"`
+	LastErrorMessage string `json:"lastError,omitempty"`
+
+	KeyCount int      `json:"keyCount"`
+	KeyIDs   []string `json:"keyIds"`
+
+	// Loaded maps the file names and the env:/inline: sources to the key ids of the loaded keys, comma separated for several keys
+	Loaded map[string]string `json:"loaded"`
+
+	// Skipped maps the skipped file names to the reason
+	Skipped map[string]string `json:"skipped"`
+
+	// Failed maps the bad key files left out with PartialLoad to the error
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// Status returns a snapshot of the keyloader state, useful for admin pages and alerts
+func (kl *Keyloader) Status() Status {
+	kl.m.RLock()
+	defer kl.m.RUnlock()
+
+	st := Status{
+		Dir:         kl.config.Dir,
+		LoadTime:    kl.keysLoadTimestamp,
+		LastAttempt: kl.lastAttempt,
+		NextReload:  kl.nextReload,
+		LastError:   kl.lastError,
+		KeyIDs:      snapshot.KeyIDs(kl.keys),
+		Loaded:      snapshot.CopyMap(kl.loaded),
+		Skipped:     snapshot.CopyMap(kl.skipped),
+		Failed:      snapshot.CopyMap(kl.failed),
+	}
+
+	if kl.lastError != nil {
+		st.LastErrorMessage = kl.lastError.Error()
+	}
+
+	if kl.keys != nil {
+		st.KeyCount = kl.keys.Len()
+	}
+
+	return st
+}
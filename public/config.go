@@ -0,0 +1,50 @@
+package public
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dimovnike/go-jwksclient/internal/keyloader"
+
+	"github.com/rs/zerolog"
+)
+
+type Config struct {
+	// the directory to load the keys from
+	Dir string
+
+	// set to 0 to disable watching
+	WatchInterval time.Duration
+
+	// fail on error, actually return the error, otherwise just log it
+	FailOnError bool
+
+	// the alg set on RSA keys without one: RS256, RS384, RS512, PS256, PS384 or PS512, empty means RS256
+	RSAAlgorithm string
+
+	// logger
+	Logger *zerolog.Logger
+}
+
+// NewConfig creates a new config with default values
+func NewConfig() Config {
+	return Config{
+		Dir:           "./keys",
+		WatchInterval: 1 * time.Second,
+		FailOnError:   false,
+		RSAAlgorithm:  keyloader.DefaultRSAAlgorithm,
+		Logger:        &zerolog.Logger{},
+	}
+}
+
+func (c *Config) Validate() error {
+	if c.Dir == "" {
+		return errors.New("key-dir is required")
+	}
+
+	return keyloader.ValidateRSAAlgorithm(&c.RSAAlgorithm)
+}
+
+func (c *Config) WatchOn() bool {
+	return c.WatchInterval > 0
+}
@@ -0,0 +1,158 @@
+package public
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dimovnike/go-jwksclient/internal/keyloader"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+/*
+	this package watches a directory for changes and loads public keys from files in that directory
+	it is the verification counterpart of the private package, services that only verify tokens
+	can mount just the public keys
+
+	supported are PUBLIC KEY and RSA PUBLIC KEY PEM, CERTIFICATE PEM and JWK or JWKS JSON files
+	key Id is derived from the file name without the extension, keys from JWK files keep their kid
+	to ignore a file, add a .ignore extension
+*/
+
+type Option func(*Keyloader)
+type RefreshCallback func(jwk.Set)
+
+func WithContext(ctx context.Context) Option {
+	return func(kl *Keyloader) {
+		kl.opts.Context = ctx
+	}
+}
+
+func WithRefreshCallback(rcb RefreshCallback) Option {
+	return func(kl *Keyloader) {
+		kl.opts.RefreshCallback = rcb
+	}
+}
+
+// WithWaitFirstFetch waits for the first fetch to complete before returning from New
+func WithWaitFirstFetch() Option {
+	return func(kl *Keyloader) {
+		kl.opts.WaitFirstFetch = true
+	}
+}
+
+// WithWaitGroup adds a wait group to the keyloader, it will be done when the watching stops
+func WithWaitGroup(wg *sync.WaitGroup) Option {
+	return func(kl *Keyloader) {
+		kl.opts.WaitGroup = wg
+	}
+}
+
+type Keyloader struct {
+	config Config
+	opts   keyloader.Options
+
+	// the keys loaded from the directory
+	keys              jwk.Set
+	keysLoadTimestamp time.Time
+
+	// the mutex to protect the keys and keysTimestamp
+	m sync.RWMutex
+}
+
+func NewKeyloader(config Config, opts ...Option) (*Keyloader, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	kl := &Keyloader{
+		config: config,
+		opts:   keyloader.NewOptions(),
+	}
+
+	for _, opt := range opts {
+		opt(kl)
+	}
+
+	if kl.opts.WaitFirstFetch {
+		if err := kl.LoadKeys(); err != nil {
+			return nil, err
+		}
+	}
+
+	if kl.opts.WaitGroup != nil {
+		kl.opts.WaitGroup.Add(1)
+	}
+	go kl.LoadKeysWatch(kl.opts.Context)
+
+	return kl, nil
+}
+
+func (kl *Keyloader) GetKeysLoadTime() time.Time {
+	kl.m.RLock()
+	defer kl.m.RUnlock()
+
+	return kl.keysLoadTimestamp
+}
+
+// GetKeys returns the verification key set
+func (kl *Keyloader) GetKeys() (jwk.Set, time.Time, error) {
+	kl.m.RLock()
+	defer kl.m.RUnlock()
+
+	if kl.keys == nil {
+		return nil, time.Time{}, errors.New("keys not loaded")
+	}
+
+	return kl.keys, kl.keysLoadTimestamp, nil
+}
+
+// KeySet returns the keys like GetKeys, it matches jwksclient.CompositeMember.KeySet
+func (kl *Keyloader) KeySet(context.Context) (jwk.Set, error) {
+	ks, _, err := kl.GetKeys()
+	return ks, err
+}
+
+// LoadKeysWatch starts watching the directory for changes and loads the keys
+// it honors the FailOnError config option
+func (kl *Keyloader) LoadKeysWatch(ctx context.Context) error {
+	if kl.opts.WaitGroup != nil {
+		defer kl.opts.WaitGroup.Done()
+	}
+
+	return keyloader.Watch(ctx, keyloader.WatchConfig{
+		Dir:         kl.config.Dir,
+		Interval:    kl.config.WatchInterval,
+		FailOnError: kl.config.FailOnError,
+		Logger:      kl.config.Logger,
+		WaitGroup:   kl.opts.WaitGroup,
+	}, kl.LoadKeys)
+}
+
+// LoadKeys loads the keys once, the refresh callback is called with the new keys
+// it honors the FailOnError config option
+func (kl *Keyloader) LoadKeys() error {
+	keys, err := kl.loadKeys(kl.config.Dir)
+	if err != nil {
+		if kl.config.FailOnError {
+			return err
+		}
+
+		kl.config.Logger.Error().Err(err).Msg("failed to load keys")
+		return nil // leave the old keys
+	}
+
+	kl.m.Lock()
+	kl.keys = keys
+	kl.keysLoadTimestamp = time.Now()
+	kl.m.Unlock()
+
+	// called without the lock, the callback may use the keyloader
+	if kl.opts.RefreshCallback != nil {
+		kl.opts.RefreshCallback(keys)
+	}
+
+	return nil
+}
@@ -0,0 +1,382 @@
+package public
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dimovnike/go-jwksclient/keyfiles"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+// the extensions removed from the file name to get the key id
+var keyFileExtensions = []string{".pub", ".pem", ".crt", ".cer", ".der", ".jwk", ".json"}
+
+// LoadPublicKeys loads the public keys from src, the format is detected from the content:
+//   - JSON holding a single public JWK or a JWKS, the keys keep their kid and alg
+//   - PEM with PUBLIC KEY, RSA PUBLIC KEY or CERTIFICATE blocks, a certificate followed by
+//     more certificates is a chain, it is set as x5c of the key of the first certificate
+//   - raw DER of a public key or a certificate
+//
+// keys without alg get the default alg for the key type, see defaultAlgorithm
+func (kl *Keyloader) LoadPublicKeys(src []byte) ([]jwk.Key, error) {
+	kl.config.Logger.Debug().Msgf("loading public keys (%d bytes)", len(src))
+
+	trimmed := bytes.TrimSpace(src)
+
+	var keys []jwk.Key
+	var err error
+
+	switch {
+	case len(trimmed) == 0:
+		return nil, errors.New("empty key file")
+
+	case trimmed[0] == '{':
+		keys, err = loadPublicJWKs(trimmed)
+
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN")):
+		keys, err = loadPublicPEM(trimmed)
+
+	default:
+		keys, err = loadPublicDER(src)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, key := range keys {
+		if key.Algorithm() != "" {
+			continue
+		}
+
+		alg, err := kl.defaultAlgorithm(key)
+		if err != nil {
+			return nil, fmt.Errorf("key #%d: %w", i, err)
+		}
+
+		if err := key.Set(jwk.AlgorithmKey, alg); err != nil {
+			return nil, fmt.Errorf("key #%d: set alg: %w", i, err)
+		}
+	}
+
+	return keys, nil
+}
+
+// LoadPublicKeysFromFile loads the public keys from a file, see LoadPublicKeys for the supported formats
+func (kl *Keyloader) LoadPublicKeysFromFile(file string) ([]jwk.Key, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read public key file %s: %w", file, err)
+	}
+
+	return kl.LoadPublicKeys(buf)
+}
+
+// loadPublicJWKs parses a single JWK or a JWKS, private and symmetric keys are refused
+func loadPublicJWKs(src []byte) ([]jwk.Key, error) {
+	set, err := jwk.Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("parse JWK: %w", err)
+	}
+
+	if set.Len() == 0 {
+		return nil, errors.New("JWKS has no keys")
+	}
+
+	keys := make([]jwk.Key, 0, set.Len())
+
+	for i := 0; i < set.Len(); i++ {
+		key, _ := set.Get(i)
+
+		var raw interface{}
+		if err := key.Raw(&raw); err != nil {
+			return nil, fmt.Errorf("JWK #%d: %w", i, err)
+		}
+
+		if !isPublicKey(raw) {
+			return nil, fmt.Errorf("JWK #%d is not a public key (kty %s)", i, key.KeyType())
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// loadPublicPEM parses all the PEM blocks of src
+func loadPublicPEM(src []byte) ([]jwk.Key, error) {
+	var keys []jwk.Key
+
+	// the certificates of the last key, the following certificates are added to its chain
+	var chain []*x509.Certificate
+
+	for rest := src; ; {
+		var block *pem.Block
+
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parse certificate: %w", err)
+			}
+
+			if chain != nil {
+				chain = append(chain, cert)
+
+				if err := setCertChain(keys[len(keys)-1], chain); err != nil {
+					return nil, err
+				}
+
+				continue
+			}
+
+			key, err := certificateJWK(cert)
+			if err != nil {
+				return nil, err
+			}
+
+			chain = []*x509.Certificate{cert}
+			keys = append(keys, key)
+
+		case "PUBLIC KEY", "RSA PUBLIC KEY":
+			raw, err := parsePublicKeyPEM(block)
+			if err != nil {
+				return nil, err
+			}
+
+			key, err := newPublicJWK(raw)
+			if err != nil {
+				return nil, err
+			}
+
+			chain = nil
+			keys = append(keys, key)
+
+		default:
+			return nil, fmt.Errorf("unsupported public key PEM type: %s", block.Type)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no public key found in PEM")
+	}
+
+	return keys, nil
+}
+
+func parsePublicKeyPEM(block *pem.Block) (crypto.PublicKey, error) {
+	if block.Type == "RSA PUBLIC KEY" {
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse RSA public key: %w", err)
+		}
+
+		return key, nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+
+	return key, nil
+}
+
+// loadPublicDER parses a DER encoded public key or certificate
+func loadPublicDER(der []byte) ([]jwk.Key, error) {
+	if raw, err := x509.ParsePKIXPublicKey(der); err == nil {
+		key, err := newPublicJWK(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		return []jwk.Key{key}, nil
+	}
+
+	if cert, err := x509.ParseCertificate(der); err == nil {
+		key, err := certificateJWK(cert)
+		if err != nil {
+			return nil, err
+		}
+
+		return []jwk.Key{key}, nil
+	}
+
+	return nil, errors.New("unrecognized key format, expected JWK, PEM or DER (public key or certificate)")
+}
+
+// certificateJWK creates the JWK of the certificate public key with the certificate as x5c
+func certificateJWK(cert *x509.Certificate) (jwk.Key, error) {
+	key, err := newPublicJWK(cert.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("certificate %s: %w", cert.Subject, err)
+	}
+
+	if err := setCertChain(key, []*x509.Certificate{cert}); err != nil {
+		return nil, err
+	}
+
+	thumbprint := sha256.Sum256(cert.Raw)
+
+	if err := key.Set(jwk.X509CertThumbprintS256Key, base64.RawURLEncoding.EncodeToString(thumbprint[:])); err != nil {
+		return nil, fmt.Errorf("set x5t#S256: %w", err)
+	}
+
+	return key, nil
+}
+
+func setCertChain(key jwk.Key, chain []*x509.Certificate) error {
+	x5c := make([]string, 0, len(chain))
+	for _, cert := range chain {
+		x5c = append(x5c, base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+
+	if err := key.Set(jwk.X509CertChainKey, x5c); err != nil {
+		return fmt.Errorf("set x5c: %w", err)
+	}
+
+	return nil
+}
+
+func newPublicJWK(raw crypto.PublicKey) (jwk.Key, error) {
+	if !isPublicKey(raw) {
+		return nil, fmt.Errorf("unsupported public key type: %T", raw)
+	}
+
+	key, err := jwk.New(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create verification JWK: %w", err)
+	}
+
+	return key, nil
+}
+
+func isPublicKey(raw interface{}) bool {
+	switch raw.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return true
+	}
+
+	return false
+}
+
+// defaultAlgorithm returns the signature algorithm for the key
+// EC keys use ES256, ES384 or ES512 by curve, RSA keys use the RSAAlgorithm config option and Ed25519 keys use EdDSA
+func (kl *Keyloader) defaultAlgorithm(key jwk.Key) (jwa.SignatureAlgorithm, error) {
+	var raw interface{}
+	if err := key.Raw(&raw); err != nil {
+		return "", err
+	}
+
+	switch pub := raw.(type) {
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return jwa.ES256, nil
+		case elliptic.P384():
+			return jwa.ES384, nil
+		case elliptic.P521():
+			return jwa.ES512, nil
+		}
+
+		return "", fmt.Errorf("unsupported EC curve: %s", pub.Curve.Params().Name)
+
+	case *rsa.PublicKey:
+		return jwa.SignatureAlgorithm(kl.config.RSAAlgorithm), nil
+
+	case ed25519.PublicKey:
+		return jwa.EdDSA, nil
+	}
+
+	return "", fmt.Errorf("unsupported public key type: %T", raw)
+}
+
+// keyIDFromFileName removes the known key file extension from the file name
+func keyIDFromFileName(name string) string {
+	lower := strings.ToLower(name)
+
+	for _, ext := range keyFileExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+
+	return name
+}
+
+// loadKeys loads the verification keys from dir
+func (kl *Keyloader) loadKeys(dir string) (jwk.Set, error) {
+	fileMetadata, skipped, err := keyfiles.GetFileMetadata(dir)
+	if err != nil {
+		return nil, fmt.Errorf("getting file metadata: %w", err)
+	}
+
+	keySet := jwk.NewSet()
+
+	loaded := map[string]string{}
+
+	for _, f := range fileMetadata {
+		fullPath := filepath.Join(dir, f.Name)
+
+		keys, err := kl.LoadPublicKeysFromFile(fullPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading key from %s: %w", fullPath, err)
+		}
+
+		baseId := keyIDFromFileName(f.Name)
+		keyIds := make([]string, 0, len(keys))
+
+		for i, key := range keys {
+			// keys from JWK files keep their kid, a file with several keys numbers them
+			keyId := key.KeyID()
+			if keyId == "" {
+				keyId = baseId
+				if len(keys) > 1 {
+					keyId = fmt.Sprintf("%s-%d", baseId, i)
+				}
+			}
+
+			if _, ok := keySet.LookupKeyID(keyId); ok {
+				kl.config.Logger.Warn().Str("filename", f.Name).Str("keyId", keyId).Msg("key id already loaded")
+			}
+
+			key.Set(jwk.KeyIDKey, keyId)
+
+			if key.KeyUsage() == "" {
+				key.Set(jwk.KeyUsageKey, jwk.ForSignature)
+			}
+
+			keySet.Add(key)
+
+			keyIds = append(keyIds, keyId)
+		}
+
+		loaded[f.Name] = strings.Join(keyIds, ",")
+	}
+
+	if len(skipped) > 0 {
+		kl.config.Logger.Info().Interface("skipped", skipped).Interface("loaded", loaded).Msg("loaded public keys")
+	}
+
+	return keySet, nil
+}
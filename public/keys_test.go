@@ -0,0 +1,213 @@
+package public
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+func TestLoadPublicKeys(t *testing.T) {
+	ec256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+
+	pkix256, err := x509.MarshalPKIXPublicKey(&ec256.PublicKey)
+	if err != nil {
+		t.Fatal("failed to marshal key:", err)
+	}
+
+	leaf := mkCertificate(t, ec256)
+	issuer := mkCertificate(t, rsaKey)
+
+	privateJWK, err := jwk.New(ec256)
+	if err != nil {
+		t.Fatal("failed to create JWK:", err)
+	}
+
+	privateJWK.Set(jwk.KeyIDKey, "jwk-kid")
+
+	publicJWK, err := jwk.PublicKeyOf(privateJWK)
+	if err != nil {
+		t.Fatal("failed to create JWK:", err)
+	}
+
+	tests := []struct {
+		name     string
+		src      []byte
+		wantAlgs []jwa.SignatureAlgorithm
+		wantX5C  int
+		wantErr  bool
+	}{
+		{
+			name:     "PUBLIC KEY PEM",
+			src:      pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix256}),
+			wantAlgs: []jwa.SignatureAlgorithm{jwa.ES256},
+		},
+		{
+			name:     "RSA PUBLIC KEY PEM",
+			src:      pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)}),
+			wantAlgs: []jwa.SignatureAlgorithm{jwa.RS256},
+		},
+		{
+			name: "certificate chain",
+			src: append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}),
+				pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issuer.Raw})...),
+			wantAlgs: []jwa.SignatureAlgorithm{jwa.ES256},
+			wantX5C:  2,
+		},
+		{
+			name: "two public keys",
+			src: append(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix256}),
+				pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)})...),
+			wantAlgs: []jwa.SignatureAlgorithm{jwa.ES256, jwa.RS256},
+		},
+		{
+			name:     "certificate DER",
+			src:      leaf.Raw,
+			wantAlgs: []jwa.SignatureAlgorithm{jwa.ES256},
+			wantX5C:  1,
+		},
+		{
+			name:     "public JWK",
+			src:      mustJSON(t, publicJWK),
+			wantAlgs: []jwa.SignatureAlgorithm{jwa.ES256},
+		},
+		{
+			name:    "private JWK",
+			src:     mustJSON(t, privateJWK),
+			wantErr: true,
+		},
+		{
+			name:    "private key PEM",
+			src:     pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte{1, 2, 3}}),
+			wantErr: true,
+		},
+		{
+			name:    "garbage",
+			src:     []byte{1, 2, 3},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kl := &Keyloader{config: NewConfig()}
+
+			got, err := kl.LoadPublicKeys(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadPublicKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if len(got) != len(tt.wantAlgs) {
+				t.Fatalf("LoadPublicKeys() got %d keys, want %d", len(got), len(tt.wantAlgs))
+			}
+
+			for i, key := range got {
+				if key.Algorithm() != tt.wantAlgs[i].String() {
+					t.Errorf("LoadPublicKeys() key %d alg = %s, want %s", i, key.Algorithm(), tt.wantAlgs[i])
+				}
+			}
+
+			if n := len(got[0].X509CertChain()); n != tt.wantX5C {
+				t.Errorf("LoadPublicKeys() x5c has %d certificates, want %d", n, tt.wantX5C)
+			}
+		})
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	ec256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+
+	pkix256, err := x509.MarshalPKIXPublicKey(&ec256.PublicKey)
+	if err != nil {
+		t.Fatal("failed to marshal key:", err)
+	}
+
+	dir := t.TempDir()
+
+	files := map[string][]byte{
+		"one.pem":         pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix256}),
+		"two.crt":         pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: mkCertificate(t, ec256).Raw}),
+		"three.pub":       pkix256,
+		"four.pem.ignore": []byte("not a key"),
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o600); err != nil {
+			t.Fatal("failed to write key file:", err)
+		}
+	}
+
+	kl := &Keyloader{config: NewConfig()}
+
+	ks, err := kl.loadKeys(dir)
+	if err != nil {
+		t.Fatal("loadKeys() error:", err)
+	}
+
+	if ks.Len() != 3 {
+		t.Errorf("loadKeys() got %d keys, want 3", ks.Len())
+	}
+
+	for _, kid := range []string{"one", "two", "three"} {
+		if _, ok := ks.LookupKeyID(kid); !ok {
+			t.Errorf("loadKeys() key %s not found", kid)
+		}
+	}
+}
+
+func mkCertificate(t *testing.T, key crypto.Signer) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal("failed to create certificate:", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("failed to parse certificate:", err)
+	}
+
+	return cert
+}
+
+func mustJSON(t *testing.T, v interface{}) []byte {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal("failed to marshal:", err)
+	}
+
+	return buf
+}
@@ -0,0 +1,68 @@
+package jwksclient
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// readThroughRefresh refreshes the cache on behalf of GetKeySet
+// if there is no key set yet it waits for the fetch, if the key set has expired it refreshes in the background
+func (c *Client) readThroughRefresh(ctx context.Context) error {
+	c.m.RLock()
+	expired := time.Now().After(c.cacheExpiresAfter)
+	missing := c.cachedJWKSet == nil
+	c.m.RUnlock()
+
+	if !expired {
+		return nil
+	}
+
+	if !missing {
+		if atomic.CompareAndSwapInt32(&c.readThroughRunning, 0, 1) {
+			go func() {
+				defer atomic.StoreInt32(&c.readThroughRunning, 0)
+				c.readThroughFetch()
+			}()
+		}
+
+		// serve the current keys meanwhile
+		return nil
+	}
+
+	// the fetch runs with the client context, so a caller giving up does not cancel it for the others
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		c.readThroughFetch()
+	}()
+
+	select {
+	case <-done:
+		return nil
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readThroughFetch performs a single refresh, concurrent callers wait for it and then find a valid cache
+func (c *Client) readThroughFetch() {
+	c.readThroughM.Lock()
+	defer c.readThroughM.Unlock()
+
+	refreshed, err := c.Refresh(false)
+	if err != nil {
+		log.Error().Err(err).Msg("read-through refresh failed")
+	}
+
+	if refreshed {
+		log.Info().Msg("JWKS refreshed")
+
+		if c.rcb != nil {
+			ks, err := c.keySet()
+			c.rcb(ks, err)
+		}
+	}
+}
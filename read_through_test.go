@@ -0,0 +1,172 @@
+package jwksclient
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadThrough(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// a key set is loaded and expired before the test calls
+		stale bool
+
+		// the number of concurrent GetKeySet calls
+		callers int
+
+		// the server blocks the requests after the first until released
+		block bool
+
+		// the GetKeySet context timeout, 0 means no timeout
+		timeout time.Duration
+
+		wantRequests int32
+		wantErr      error
+	}{
+		{
+			name:         "no key set is fetched synchronously",
+			callers:      1,
+			wantRequests: 1,
+		},
+		{
+			name:         "concurrent callers share a single fetch",
+			callers:      20,
+			wantRequests: 1,
+		},
+		{
+			name:         "stale key set is served while refreshed in the background",
+			stale:        true,
+			callers:      20,
+			block:        true,
+			wantRequests: 2,
+		},
+		{
+			name:         "caller gives up on a slow fetch",
+			callers:      1,
+			block:        true,
+			timeout:      50 * time.Millisecond,
+			wantRequests: 1,
+			wantErr:      context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			release := make(chan struct{})
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&requests, 1)
+
+				// without a loaded set the first request blocks too
+				if tt.block && (n > 1 || !tt.stale) {
+					<-release
+				}
+
+				w.Write(mkJWKS("k1"))
+			}))
+			defer srv.Close()
+			defer close(release)
+
+			cfg := NewConfig()
+			cfg.URL = srv.URL
+
+			c, err := New(cfg, WithReadThrough())
+			if err != nil {
+				t.Fatal("New() error:", err)
+			}
+
+			if tt.stale {
+				if _, err := c.GetKeySet(context.Background()); err != nil {
+					t.Fatal("GetKeySet() error:", err)
+				}
+
+				c.m.Lock()
+				c.cacheExpiresAfter = time.Now().Add(-time.Second)
+				c.m.Unlock()
+			}
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			errs := make(chan error, tt.callers)
+			var wg sync.WaitGroup
+
+			for i := 0; i < tt.callers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					ks, err := c.GetKeySet(ctx)
+					if err == nil && ks.Len() != 1 {
+						err = fmt.Errorf("got %d keys", ks.Len())
+					}
+
+					errs <- err
+				}()
+			}
+
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("GetKeySet() error = %v, want %v", err, tt.wantErr)
+				}
+			}
+
+			if tt.stale {
+				// the background refresh is still blocked, a single one is running
+				waitFor(t, func() bool { return atomic.LoadInt32(&requests) == tt.wantRequests })
+
+				if atomic.LoadInt32(&c.readThroughRunning) != 1 {
+					t.Error("background refresh not running")
+				}
+
+				release <- struct{}{}
+				waitFor(t, func() bool { return atomic.LoadInt32(&c.readThroughRunning) == 0 })
+			}
+
+			if got := atomic.LoadInt32(&requests); got != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+// mkJWKS returns a JWKS document with a symmetric key for each kid, the key material is derived from the kid
+func mkJWKS(kids ...string) []byte {
+	keys := make([]string, 0, len(kids))
+	for _, kid := range kids {
+		keys = append(keys, fmt.Sprintf(`{"kty":"oct","k":"%s","kid":"%s"}`, base64.RawURLEncoding.EncodeToString([]byte(kid)), kid))
+	}
+
+	return []byte(`{"keys":[` + strings.Join(keys, ",") + `]}`)
+}
+
+// waitFor waits until cond is true or fails the test after a second
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the condition")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
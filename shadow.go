@@ -0,0 +1,237 @@
+package jwksclient
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+/*
+	A shadow URL is fetched after every successful refresh of the primary URL, its keys are compared
+	with the primary ones but never used. This allows checking that a new IdP deployment publishes
+	the same keys before cutting the traffic over. The differences are passed to the ShadowCallback
+	and counted in Status.
+*/
+
+// ShadowDiff is the result of comparing the primary and the shadow key sets
+type ShadowDiff struct {
+	URL string `json:"url"`
+
+	// key ids present in one of the sets only
+	OnlyPrimary []string `json:"onlyPrimary,omitempty"`
+	OnlyShadow  []string `json:"onlyShadow,omitempty"`
+
+	// key ids present in both sets but with different RFC 7638 thumbprints
+	ThumbprintMismatch []string `json:"thumbprintMismatch,omitempty"`
+
+	// the cache lifetimes derived from the response headers, 0 if there are no cache headers
+	PrimaryCacheLifetime time.Duration `json:"primaryCacheLifetime"`
+	ShadowCacheLifetime  time.Duration `json:"shadowCacheLifetime"`
+
+	// Err is set when the shadow URL could not be fetched, the other fields are empty then
+	Err        error  `json:"-"`
+	ErrMessage string `json:"error,omitempty"`
+}
+
+// Equal reports whether the shadow serves the same keys with the same cache lifetime as the primary
+func (d ShadowDiff) Equal() bool {
+	return d.Err == nil &&
+		len(d.OnlyPrimary) == 0 &&
+		len(d.OnlyShadow) == 0 &&
+		len(d.ThumbprintMismatch) == 0 &&
+		d.PrimaryCacheLifetime == d.ShadowCacheLifetime
+}
+
+// ShadowCallback is called with the result of every comparison
+type ShadowCallback func(diff ShadowDiff)
+
+// ShadowStatus holds the comparison counters of the shadow URL, see Status
+type ShadowStatus struct {
+	URL         string      `json:"url"`
+	Comparisons int64       `json:"comparisons"`
+	Mismatches  int64       `json:"mismatches"`
+	Errors      int64       `json:"errors"`
+	LastCompare time.Time   `json:"lastCompare"`
+	LastDiff    *ShadowDiff `json:"lastDiff,omitempty"`
+}
+
+// WithShadow fetches the shadow URL alongside the primary one and compares the keys, the shadow keys are never used
+// the comparisons run in the background using the same http client and parsing as the primary URL
+// the headers, request mutators and access token of the primary URL are not sent to the shadow, see WithShadowAuth
+func WithShadow(url string, cb ShadowCallback) Option {
+	return func(c *Client) {
+		c.shadow = &shadow{
+			url: url,
+			cb:  cb,
+		}
+	}
+}
+
+// WithShadowAuth sends the headers, request mutators and access token of the primary URL to the shadow URL too
+// use it only when the shadow is trusted with the credentials of the primary
+func WithShadowAuth() Option {
+	return func(c *Client) {
+		c.shadowAuth = true
+	}
+}
+
+type shadow struct {
+	url     string
+	source  Source
+	cb      ShadowCallback
+	running int32
+
+	// the last fetched shadow keys, used when the source reports NotModified
+	lastKeys jwk.Set
+	lastResp *SourceResponse
+
+	m      sync.Mutex
+	status ShadowStatus
+}
+
+// compareAsync starts a comparison unless one is already running
+func (s *shadow) compareAsync(c *Client, primary jwk.Set, primaryHeaders http.Header) {
+	if !atomic.CompareAndSwapInt32(&s.running, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&s.running, 0)
+
+		diff := s.compare(c, primary, primaryHeaders)
+
+		s.record(diff)
+
+		if s.cb != nil {
+			s.cb(diff)
+		}
+	}()
+}
+
+func (s *shadow) compare(c *Client, primary jwk.Set, primaryHeaders http.Header) ShadowDiff {
+	diff := ShadowDiff{URL: s.url}
+
+	shadowKeys, resp, err := c.get(s.source)
+	if err == nil && resp.NotModified {
+		if s.lastKeys == nil {
+			err = errors.New("shadow key set not modified since the last failed fetch")
+		}
+
+		shadowKeys, resp = s.lastKeys, s.lastResp
+	}
+
+	if err != nil {
+		diff.Err = err
+		diff.ErrMessage = err.Error()
+
+		return diff
+	}
+
+	s.lastKeys, s.lastResp = shadowKeys, resp
+
+	now := time.Now()
+	diff.PrimaryCacheLifetime = cacheLifetime(now, primaryHeaders)
+	diff.ShadowCacheLifetime = cacheLifetime(now, resp.Header)
+
+	primaryPrints := thumbprints(primary)
+	shadowPrints := thumbprints(shadowKeys)
+
+	for kid, tp := range primaryPrints {
+		stp, ok := shadowPrints[kid]
+
+		switch {
+		case !ok:
+			diff.OnlyPrimary = append(diff.OnlyPrimary, kid)
+		case stp != tp:
+			diff.ThumbprintMismatch = append(diff.ThumbprintMismatch, kid)
+		}
+	}
+
+	for kid := range shadowPrints {
+		if _, ok := primaryPrints[kid]; !ok {
+			diff.OnlyShadow = append(diff.OnlyShadow, kid)
+		}
+	}
+
+	sort.Strings(diff.OnlyPrimary)
+	sort.Strings(diff.OnlyShadow)
+	sort.Strings(diff.ThumbprintMismatch)
+
+	return diff
+}
+
+func (s *shadow) record(diff ShadowDiff) {
+	l := log.Debug()
+	if !diff.Equal() {
+		l = log.Warn()
+	}
+
+	l.Err(diff.Err).
+		Str("url", diff.URL).
+		Strs("onlyPrimary", diff.OnlyPrimary).
+		Strs("onlyShadow", diff.OnlyShadow).
+		Strs("thumbprintMismatch", diff.ThumbprintMismatch).
+		Dur("primaryCacheLifetime", diff.PrimaryCacheLifetime).
+		Dur("shadowCacheLifetime", diff.ShadowCacheLifetime).
+		Msg("shadow key set compared")
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.status.Comparisons++
+	s.status.LastCompare = time.Now()
+	s.status.LastDiff = &diff
+
+	if diff.Err != nil {
+		s.status.Errors++
+	} else if !diff.Equal() {
+		s.status.Mismatches++
+	}
+}
+
+func (s *shadow) getStatus() *ShadowStatus {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	st := s.status
+	st.URL = s.url
+
+	return &st
+}
+
+// cacheLifetime returns the cache lifetime derived from the headers, 0 if there are no usable cache headers
+func cacheLifetime(now time.Time, headers http.Header) time.Duration {
+	exp, err := expiresAfter(now, headers)
+	if err != nil {
+		return 0
+	}
+
+	return exp.Sub(now)
+}
+
+// thumbprints returns the base64url encoded RFC 7638 SHA-256 thumbprints of the keys by key id
+func thumbprints(ks jwk.Set) map[string]string {
+	prints := make(map[string]string, ks.Len())
+
+	for it := ks.Iterate(context.Background()); it.Next(context.Background()); {
+		key := it.Pair().Value.(jwk.Key)
+
+		tp, err := key.Thumbprint(crypto.SHA256)
+		if err != nil {
+			prints[key.KeyID()] = "error: " + err.Error()
+			continue
+		}
+
+		prints[key.KeyID()] = base64.RawURLEncoding.EncodeToString(tp)
+	}
+
+	return prints
+}
@@ -0,0 +1,91 @@
+package jwksclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestShadowAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		shadowAuth bool
+		wantAuth   string
+		wantAPIKey string
+	}{
+		{
+			name: "credentials are not sent to the shadow",
+		},
+		{
+			name:       "credentials are sent to the shadow on request",
+			shadowAuth: true,
+			wantAuth:   "Bearer secret",
+			wantAPIKey: "key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer secret" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
+				w.Write(mkJWKS("k1"))
+			}))
+			defer primary.Close()
+
+			headers := make(chan http.Header, 1)
+
+			shadowSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				headers <- r.Header.Clone()
+				w.Write(mkJWKS("k1"))
+			}))
+			defer shadowSrv.Close()
+
+			diffs := make(chan ShadowDiff, 1)
+
+			cfg := NewConfig()
+			cfg.URL = primary.URL
+
+			opts := []Option{
+				WithBearerToken("secret"),
+				WithHeaders(http.Header{"X-Api-Key": {"key"}}),
+				WithShadow(shadowSrv.URL, func(diff ShadowDiff) { diffs <- diff }),
+			}
+
+			if tt.shadowAuth {
+				opts = append(opts, WithShadowAuth())
+			}
+
+			c, err := New(cfg, opts...)
+			if err != nil {
+				t.Fatal("New() error:", err)
+			}
+
+			if _, err := c.Refresh(true); err != nil {
+				t.Fatal("Refresh() error:", err)
+			}
+
+			var h http.Header
+			select {
+			case h = <-headers:
+			case <-time.After(time.Second):
+				t.Fatal("the shadow URL was not fetched")
+			}
+
+			if got := h.Get("Authorization"); got != tt.wantAuth {
+				t.Errorf("shadow got Authorization %q, want %q", got, tt.wantAuth)
+			}
+
+			if got := h.Get("X-Api-Key"); got != tt.wantAPIKey {
+				t.Errorf("shadow got X-Api-Key %q, want %q", got, tt.wantAPIKey)
+			}
+
+			if diff := <-diffs; !diff.Equal() {
+				t.Errorf("got diff %+v, want equal key sets", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package jwksclient
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dimovnike/go-jwksclient/internal/snapshot"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+/*
+	The shrinkage check protects against an IdP briefly serving a truncated or empty key set.
+	A new key set that drops more than ShrinkThreshold of the current key ids, or is empty,
+	is held as pending while the current keys keep being served. The pending set is applied
+	once it was fetched ShrinkConfirmations more times in a row or after ShrinkTimeout.
+*/
+
+// PendingKeySet describes a key set held back by the shrinkage check, see Status
+type PendingKeySet struct {
+	KeyIDs        []string  `json:"keyIds"`
+	Since         time.Time `json:"since"`
+	Confirmations int       `json:"confirmations"`
+	Reason        string    `json:"reason"`
+}
+
+// shrinkage is the state of the shrinkage check
+type shrinkage struct {
+	pending *PendingKeySet
+
+	// the fetch of the pending key set, evaluated again when the source reports NotModified
+	held *fetchResult
+
+	decision string
+}
+
+// checkShrinkage decides whether the new key set replaces the current one, it returns nil if the set is held
+// must be called with the lock held
+func (c *Client) checkShrinkage(ks jwk.Set, now time.Time) jwk.Set {
+	if c.config.ShrinkThreshold <= 0 || c.cachedJWKSet == nil {
+		return ks
+	}
+
+	current := snapshot.KeyIDs(c.cachedJWKSet)
+	next := snapshot.KeyIDs(ks)
+
+	reason := shrinkReason(current, next, c.config.ShrinkThreshold)
+	if reason == "" {
+		if c.shrinkage.pending != nil {
+			c.recordShrinkDecision("pending key set discarded, the new key set is not suspicious")
+		}
+
+		c.shrinkage.pending = nil
+
+		return ks
+	}
+
+	p := c.shrinkage.pending
+
+	if p != nil && sameKeyIDs(p.KeyIDs, next) {
+		p.Confirmations++
+	} else {
+		p = &PendingKeySet{
+			KeyIDs: next,
+			Since:  now,
+			Reason: reason,
+		}
+
+		c.shrinkage.pending = p
+	}
+
+	switch {
+	case c.config.ShrinkConfirmations > 0 && p.Confirmations >= c.config.ShrinkConfirmations:
+		c.recordShrinkDecision(fmt.Sprintf("pending key set accepted after %d confirmations: %s", p.Confirmations, p.Reason))
+
+	case c.config.ShrinkTimeout > 0 && now.Sub(p.Since) >= c.config.ShrinkTimeout:
+		c.recordShrinkDecision(fmt.Sprintf("pending key set accepted after being pending for %s: %s", now.Sub(p.Since), p.Reason))
+
+	default:
+		c.recordShrinkDecision(fmt.Sprintf("key set held as pending (%d confirmations): %s", p.Confirmations, p.Reason))
+		return nil
+	}
+
+	c.shrinkage.pending = nil
+
+	return ks
+}
+
+func (c *Client) recordShrinkDecision(decision string) {
+	log.Warn().Str("decision", decision).Msg("key set shrinkage check")
+
+	c.shrinkage.decision = decision
+}
+
+// shrinkReason returns why the change from current to next is suspicious, empty if it is not
+func shrinkReason(current, next []string, threshold float64) string {
+	if len(next) == 0 {
+		return "the new key set is empty"
+	}
+
+	if len(current) == 0 {
+		return ""
+	}
+
+	nextKids := make(map[string]bool, len(next))
+	for _, kid := range next {
+		nextKids[kid] = true
+	}
+
+	dropped := 0
+	for _, kid := range current {
+		if !nextKids[kid] {
+			dropped++
+		}
+	}
+
+	if fraction := float64(dropped) / float64(len(current)); fraction > threshold {
+		return fmt.Sprintf("the new key set drops %d of %d key ids", dropped, len(current))
+	}
+
+	return ""
+}
+
+func sameKeyIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+
+	sort.Strings(a)
+	sort.Strings(b)
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
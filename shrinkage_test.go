@@ -0,0 +1,226 @@
+package jwksclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShrinkage(t *testing.T) {
+	type step struct {
+		serve []string
+
+		// move the start of the pending key set this far back before the refresh
+		agePending time.Duration
+
+		wantRefreshed bool
+		wantKeys      []string
+		wantPending   bool
+	}
+
+	tests := []struct {
+		name          string
+		confirmations int
+		timeout       time.Duration
+		steps         []step
+	}{
+		{
+			name:          "shrunk key set is held",
+			confirmations: 3,
+			steps: []step{
+				{serve: []string{"k1"}, wantKeys: []string{"k1", "k2", "k3"}, wantPending: true},
+				{serve: []string{"k1"}, wantKeys: []string{"k1", "k2", "k3"}, wantPending: true},
+			},
+		},
+		{
+			name:          "empty key set is held",
+			confirmations: 3,
+			steps: []step{
+				{serve: []string{}, wantKeys: []string{"k1", "k2", "k3"}, wantPending: true},
+			},
+		},
+		{
+			name:          "small change is applied",
+			confirmations: 3,
+			steps: []step{
+				{serve: []string{"k1", "k2", "k4"}, wantRefreshed: true, wantKeys: []string{"k1", "k2", "k4"}},
+			},
+		},
+		{
+			name:          "pending key set is accepted after the confirmations",
+			confirmations: 2,
+			steps: []step{
+				{serve: []string{"k1"}, wantKeys: []string{"k1", "k2", "k3"}, wantPending: true},
+				{serve: []string{"k1"}, wantKeys: []string{"k1", "k2", "k3"}, wantPending: true},
+				{serve: []string{"k1"}, wantRefreshed: true, wantKeys: []string{"k1"}},
+			},
+		},
+		{
+			name:          "a different shrunk set restarts the confirmations",
+			confirmations: 1,
+			steps: []step{
+				{serve: []string{"k1"}, wantKeys: []string{"k1", "k2", "k3"}, wantPending: true},
+				{serve: []string{"k2"}, wantKeys: []string{"k1", "k2", "k3"}, wantPending: true},
+				{serve: []string{"k2"}, wantRefreshed: true, wantKeys: []string{"k2"}},
+			},
+		},
+		{
+			name:    "pending key set is accepted after the timeout",
+			timeout: time.Minute,
+			steps: []step{
+				{serve: []string{"k1"}, wantKeys: []string{"k1", "k2", "k3"}, wantPending: true},
+				{serve: []string{"k1"}, wantKeys: []string{"k1", "k2", "k3"}, wantPending: true},
+				{serve: []string{"k1"}, agePending: time.Minute, wantRefreshed: true, wantKeys: []string{"k1"}},
+			},
+		},
+		{
+			name:          "pending key set is discarded when the full set is back",
+			confirmations: 3,
+			steps: []step{
+				{serve: []string{"k1"}, wantKeys: []string{"k1", "k2", "k3"}, wantPending: true},
+				{serve: []string{"k1", "k2", "k3"}, wantRefreshed: true, wantKeys: []string{"k1", "k2", "k3"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m sync.Mutex
+			serve := []string{"k1", "k2", "k3"}
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				m.Lock()
+				defer m.Unlock()
+
+				w.Write(mkJWKS(serve...))
+			}))
+			defer srv.Close()
+
+			cfg := NewConfig()
+			cfg.URL = srv.URL
+			cfg.ShrinkThreshold = 0.5
+			cfg.ShrinkConfirmations = tt.confirmations
+			cfg.ShrinkTimeout = tt.timeout
+
+			c, err := New(cfg, WithWaitFirstFetch())
+			if err != nil {
+				t.Fatal("New() error:", err)
+			}
+
+			for i, s := range tt.steps {
+				m.Lock()
+				serve = s.serve
+				m.Unlock()
+
+				c.m.Lock()
+				if p := c.shrinkage.pending; p != nil {
+					p.Since = p.Since.Add(-s.agePending)
+				}
+				c.m.Unlock()
+
+				lastSuccess := c.Status().LastSuccess
+
+				refreshed, err := c.Refresh(true)
+				if err != nil {
+					t.Fatalf("step %d: Refresh() error: %v", i, err)
+				}
+
+				if refreshed != s.wantRefreshed {
+					t.Errorf("step %d: refreshed = %v, want %v", i, refreshed, s.wantRefreshed)
+				}
+
+				st := c.Status()
+
+				if !reflect.DeepEqual(st.KeyIDs, s.wantKeys) {
+					t.Errorf("step %d: got keys %v, want %v", i, st.KeyIDs, s.wantKeys)
+				}
+
+				if got := st.PendingKeySet != nil; got != s.wantPending {
+					t.Errorf("step %d: pending = %v, want %v", i, got, s.wantPending)
+				}
+
+				// a held key set is not a success, the served keys are as old as before
+				if advanced := st.LastSuccess.After(lastSuccess); advanced != s.wantRefreshed {
+					t.Errorf("step %d: last success advanced = %v, want %v", i, advanced, s.wantRefreshed)
+				}
+			}
+		})
+	}
+}
+
+func TestShrinkageNotModified(t *testing.T) {
+	tests := []struct {
+		name          string
+		confirmations int
+		timeout       time.Duration
+
+		// move the start of the pending key set this far back before the unchanged refreshes
+		agePending time.Duration
+
+		// the number of refreshes of the unchanged file until the pending set is accepted
+		wantHeld int
+	}{
+		{
+			name:          "confirmed by the unchanged file",
+			confirmations: 2,
+			wantHeld:      1,
+		},
+		{
+			name:       "accepted after the timeout with the unchanged file",
+			timeout:    time.Minute,
+			agePending: time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "jwks.json")
+
+			if err := os.WriteFile(path, mkJWKS("k1", "k2", "k3"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := NewConfig()
+			cfg.URL = "file://" + path
+			cfg.ShrinkThreshold = 0.5
+			cfg.ShrinkConfirmations = tt.confirmations
+			cfg.ShrinkTimeout = tt.timeout
+
+			c, err := New(cfg, WithWaitFirstFetch())
+			if err != nil {
+				t.Fatal("New() error:", err)
+			}
+
+			if err := os.WriteFile(path, mkJWKS("k1"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			if refreshed, err := c.Refresh(true); refreshed || err != nil {
+				t.Fatalf("Refresh() = %v, %v, want the shrunk set held", refreshed, err)
+			}
+
+			c.m.Lock()
+			c.shrinkage.pending.Since = c.shrinkage.pending.Since.Add(-tt.agePending)
+			c.m.Unlock()
+
+			for i := 0; i < tt.wantHeld; i++ {
+				if refreshed, err := c.Refresh(true); refreshed || err != nil {
+					t.Fatalf("refresh %d: Refresh() = %v, %v, want the shrunk set still held", i, refreshed, err)
+				}
+			}
+
+			if refreshed, err := c.Refresh(true); !refreshed || err != nil {
+				t.Fatalf("Refresh() = %v, %v, want the pending set accepted", refreshed, err)
+			}
+
+			st := c.Status()
+
+			if !reflect.DeepEqual(st.KeyIDs, []string{"k1"}) || st.PendingKeySet != nil {
+				t.Errorf("got keys %v, pending %v, want [k1] and no pending set", st.KeyIDs, st.PendingKeySet)
+			}
+		})
+	}
+}
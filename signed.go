@@ -0,0 +1,192 @@
+package jwksclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+/*
+	Signed key sets are served as a compact JWS (a signed JWT) instead of a bare JWKS,
+	for example the signed_jwks_uri of OpenID Federation. The JWT is verified against the
+	trust anchor key set, its exp claim is required and the keys claim becomes the key set.
+	Once enabled, unsigned responses are refused.
+*/
+
+// signedJWKS holds the settings for verifying signed key sets
+type signedJWKS struct {
+	trustAnchor jwk.Set
+	issuer      string
+	subject     string
+}
+
+// WithSignedJWKS expects the endpoint to serve the key set as a JWT signed by one of the trust anchor keys
+// the iss and sub claims are checked when not empty, the exp claim is always required
+func WithSignedJWKS(trustAnchor jwk.Set, issuer, subject string) Option {
+	return func(c *Client) {
+		c.signed = &signedJWKS{
+			trustAnchor: trustAnchor,
+			issuer:      issuer,
+			subject:     subject,
+		}
+	}
+}
+
+// parseKeySet parses the response body, verifying the signature when signed key sets are enabled
+func (c *Client) parseKeySet(body []byte) (jwk.Set, error) {
+	if c.signed != nil {
+		return c.signed.parse(body, c.config.StrictJSON)
+	}
+
+	if c.config.StrictJSON {
+		if err := checkStrictJSON(body); err != nil {
+			return nil, &ParseError{Err: fmt.Errorf("strict JSON: %w", err)}
+		}
+	}
+
+	kSet := jwk.NewSet()
+
+	if err := json.Unmarshal(body, kSet); err != nil {
+		return nil, &ParseError{Err: fmt.Errorf("unmarshalling JSON: %w", err)}
+	}
+
+	return kSet, nil
+}
+
+func (s *signedJWKS) validate() error {
+	if s.trustAnchor == nil || s.trustAnchor.Len() == 0 {
+		return errors.New("signed JWKS requires a non-empty trust anchor key set")
+	}
+
+	return nil
+}
+
+func (s *signedJWKS) parse(body []byte, strictJSON bool) (jwk.Set, error) {
+	body = bytes.TrimSpace(body)
+
+	// refuse to downgrade to an unsigned key set
+	if _, _, _, err := jws.SplitCompact(body); err != nil {
+		return nil, &PolicyError{Err: fmt.Errorf("expected a signed JWKS in JWS compact serialization: %w", err)}
+	}
+
+	payload, err := s.verify(body)
+	if err != nil {
+		return nil, &PolicyError{Err: fmt.Errorf("verifying signed JWKS: %w", err)}
+	}
+
+	if strictJSON {
+		if err := checkStrictJSON(payload); err != nil {
+			return nil, &ParseError{Err: fmt.Errorf("strict JSON: %w", err)}
+		}
+	}
+
+	token := jwt.New()
+
+	if err := json.Unmarshal(payload, token); err != nil {
+		return nil, &ParseError{Err: fmt.Errorf("unmarshalling signed JWKS claims: %w", err)}
+	}
+
+	opts := []jwt.ValidateOption{
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+	}
+
+	if s.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(s.issuer))
+	}
+
+	if s.subject != "" {
+		opts = append(opts, jwt.WithSubject(s.subject))
+	}
+
+	if err := jwt.Validate(token, opts...); err != nil {
+		return nil, &PolicyError{Err: fmt.Errorf("validating signed JWKS claims: %w", err)}
+	}
+
+	keys, ok := token.Get("keys")
+	if !ok {
+		return nil, &ParseError{Err: errors.New("signed JWKS has no keys claim")}
+	}
+
+	buf, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		return nil, &ParseError{Err: fmt.Errorf("marshalling keys claim: %w", err)}
+	}
+
+	kSet := jwk.NewSet()
+
+	if err := json.Unmarshal(buf, kSet); err != nil {
+		return nil, &ParseError{Err: fmt.Errorf("unmarshalling keys claim: %w", err)}
+	}
+
+	return kSet, nil
+}
+
+// verify checks the signature against the trust anchor keys and returns the payload
+// a key is tried only if its kid, alg and type are compatible with the JWS header
+func (s *signedJWKS) verify(body []byte) ([]byte, error) {
+	msg, err := jws.Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("parsing JWS: %w", err)
+	}
+
+	if len(msg.Signatures()) != 1 {
+		return nil, fmt.Errorf("expected one signature, got %d", len(msg.Signatures()))
+	}
+
+	headers := msg.Signatures()[0].ProtectedHeaders()
+	alg := headers.Algorithm()
+	kid := headers.KeyID()
+
+	if alg == "" || alg == jwa.NoSignature {
+		return nil, errors.New("JWS is not signed")
+	}
+
+	for it := s.trustAnchor.Iterate(context.Background()); it.Next(context.Background()); {
+		key := it.Pair().Value.(jwk.Key)
+
+		if kid != "" && key.KeyID() != kid {
+			continue
+		}
+
+		if key.Algorithm() != "" && key.Algorithm() != alg.String() {
+			continue
+		}
+
+		if usage := key.KeyUsage(); usage != "" && usage != jwk.ForSignature.String() {
+			continue
+		}
+
+		if !algorithmFitsKey(alg, key) {
+			continue
+		}
+
+		if payload, err := jws.Verify(body, alg, key); err == nil {
+			return payload, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no trust anchor key verifies the signature (kid %q, alg %s)", kid, alg)
+}
+
+// algorithmFitsKey prevents algorithm confusion, e.g. verifying HS256 with an RSA public key
+func algorithmFitsKey(alg jwa.SignatureAlgorithm, key jwk.Key) bool {
+	algs, err := jws.AlgorithmsForKey(key)
+	if err != nil {
+		return false
+	}
+
+	for _, a := range algs {
+		if a == alg {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,132 @@
+package jwksclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+func TestSignedJWKSParse(t *testing.T) {
+	anchorKey, anchorSet := mkTrustAnchor(t, "anchor")
+	otherKey, _ := mkTrustAnchor(t, "anchor")
+
+	keys := []interface{}{
+		map[string]interface{}{"kty": "oct", "k": "AAAA", "kid": "k1"},
+	}
+
+	tests := []struct {
+		name    string
+		body    func() []byte
+		issuer  string
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			body: func() []byte {
+				return mkSignedJWKS(t, anchorKey, "iss", time.Hour, keys)
+			},
+			issuer: "iss",
+		},
+		{
+			name: "unsigned key set",
+			body: func() []byte {
+				return []byte(`{"keys":[{"kty":"oct","k":"AAAA","kid":"k1"}]}`)
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			body: func() []byte {
+				return mkSignedJWKS(t, anchorKey, "iss", -time.Hour, keys)
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong issuer",
+			body: func() []byte {
+				return mkSignedJWKS(t, anchorKey, "iss", time.Hour, keys)
+			},
+			issuer:  "other",
+			wantErr: true,
+		},
+		{
+			name: "untrusted signer",
+			body: func() []byte {
+				return mkSignedJWKS(t, otherKey, "iss", time.Hour, keys)
+			},
+			wantErr: true,
+		},
+		{
+			name: "no keys claim",
+			body: func() []byte {
+				return mkSignedJWKS(t, anchorKey, "iss", time.Hour, nil)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &signedJWKS{trustAnchor: anchorSet, issuer: tt.issuer}
+
+			got, err := s.parse(tt.body(), true)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if _, ok := got.LookupKeyID("k1"); !ok || got.Len() != 1 {
+				t.Errorf("parse() got %d keys, want k1 only", got.Len())
+			}
+		})
+	}
+}
+
+func mkTrustAnchor(t *testing.T, kid string) (jwk.Key, jwk.Set) {
+	raw, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("generating key:", err)
+	}
+
+	key, err := jwk.New(raw)
+	if err != nil {
+		t.Fatal("creating JWK:", err)
+	}
+
+	key.Set(jwk.KeyIDKey, kid)
+
+	pub, err := jwk.PublicKeyOf(key)
+	if err != nil {
+		t.Fatal("public key:", err)
+	}
+
+	set := jwk.NewSet()
+	set.Add(pub)
+
+	return key, set
+}
+
+func mkSignedJWKS(t *testing.T, key jwk.Key, iss string, exp time.Duration, keys []interface{}) []byte {
+	tok := jwt.New()
+	tok.Set(jwt.IssuerKey, iss)
+	tok.Set(jwt.ExpirationKey, time.Now().Add(exp))
+
+	if keys != nil {
+		tok.Set("keys", keys)
+	}
+
+	buf, err := jwt.Sign(tok, jwa.ES256, key)
+	if err != nil {
+		t.Fatal("signing:", err)
+	}
+
+	return buf
+}
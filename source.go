@@ -0,0 +1,231 @@
+package jwksclient
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	A Source retrieves the raw key set for the Client. The source is chosen by the scheme of Config.URL:
+	http and https fetch the URL with the configured http client, file reads a local file and
+	data uses the key set inline in the URL. Custom sources are registered with RegisterSource.
+	The caching, stale keys and callback behaviour of the Client is the same for all sources.
+*/
+
+// SourceResponse is the raw key set returned by a Source
+type SourceResponse struct {
+	Body []byte
+
+	// cache metadata, the Cache-Control, Age and Expires headers are honored as for HTTP responses
+	// Content-Type is checked when Config.CheckContentType is set
+	Header http.Header
+
+	// the HTTP status code, 0 for sources that are not HTTP
+	StatusCode int
+
+	// NotModified reports that the key set did not change since the last fetch, the cached result is kept
+	NotModified bool
+}
+
+// Source fetches the raw key set, the Client calls it from a single goroutine at a time
+type Source interface {
+	Fetch(ctx context.Context) (*SourceResponse, error)
+}
+
+// SourceFactory creates a source for the URL
+type SourceFactory func(u *url.URL) (Source, error)
+
+var (
+	sourcesM sync.RWMutex
+	sources  = map[string]SourceFactory{
+		"file": newFileSource,
+		"data": newDataSource,
+	}
+)
+
+// RegisterSource registers a source for the URL scheme, http and https can not be overridden
+func RegisterSource(scheme string, factory SourceFactory) {
+	sourcesM.Lock()
+	defer sourcesM.Unlock()
+
+	sources[strings.ToLower(scheme)] = factory
+}
+
+// WithSource sets the source of the key set, Config.URL is then used for display only
+func WithSource(src Source) Option {
+	return func(c *Client) {
+		c.source = src
+	}
+}
+
+// newSource creates the source for the URL according to its scheme
+func (c *Client) newSource(rawURL string) (Source, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing URL: %w", err)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+
+	if scheme == "http" || scheme == "https" {
+		return &httpSource{client: c, url: rawURL}, nil
+	}
+
+	sourcesM.RLock()
+	factory, ok := sources[scheme]
+	sourcesM.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no source registered for URL scheme %q", u.Scheme)
+	}
+
+	return factory(u)
+}
+
+// httpSource fetches the key set with the http client of the Client
+type httpSource struct {
+	client *Client
+	url    string
+
+	// send the request without the headers, mutators and access token of the Client
+	plain bool
+}
+
+func (s *httpSource) Fetch(ctx context.Context) (*SourceResponse, error) {
+	do := s.client.do
+	if s.plain {
+		do = s.client.doPlain
+	}
+
+	resp, err := do(ctx, s.url)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	// the status is checked before the size limit, an oversized error page is still an HTTPStatusError
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, bodyExcerptSize))
+
+		return &SourceResponse{Body: body, Header: resp.Header, StatusCode: resp.StatusCode},
+			newHTTPStatusError(resp.StatusCode, resp.Header, body)
+	}
+
+	body, err := s.client.readBody(resp.Body)
+	if err != nil {
+		return &SourceResponse{Header: resp.Header, StatusCode: resp.StatusCode}, err
+	}
+
+	return &SourceResponse{
+		Body:       body,
+		Header:     resp.Header,
+		StatusCode: resp.StatusCode,
+	}, nil
+}
+
+// fileSource reads the key set from a local file, it reports NotModified while the modification time and size are unchanged
+type fileSource struct {
+	path string
+
+	modTime time.Time
+	size    int64
+}
+
+func newFileSource(u *url.URL) (Source, error) {
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, fmt.Errorf("file URL with a remote host %q is not supported", u.Host)
+	}
+
+	path := u.Path
+	if path == "" {
+		// relative paths, e.g. file:keys.json
+		path = u.Opaque
+	}
+
+	if path == "" {
+		return nil, errors.New("file URL has no path")
+	}
+
+	return &fileSource{path: path}, nil
+}
+
+func (s *fileSource) Fetch(ctx context.Context) (*SourceResponse, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, &TransportError{Op: "stat key set file", Err: err}
+	}
+
+	header := http.Header{}
+	header.Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return &SourceResponse{Header: header, NotModified: true}, nil
+	}
+
+	body, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, &TransportError{Op: "reading key set file", Err: err}
+	}
+
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+
+	return &SourceResponse{Body: body, Header: header}, nil
+}
+
+// dataSource serves the key set inline in a data URL, e.g. data:application/json;base64,eyJrZXlzIjpbXX0=
+type dataSource struct {
+	resp SourceResponse
+}
+
+func newDataSource(u *url.URL) (Source, error) {
+	// data URLs have no authority, everything after the scheme is opaque
+	raw := strings.TrimPrefix(u.String(), u.Scheme+":")
+
+	meta, data, ok := strings.Cut(raw, ",")
+	if !ok {
+		return nil, errors.New("data URL has no comma")
+	}
+
+	var body []byte
+
+	if strings.HasSuffix(meta, ";base64") {
+		meta = strings.TrimSuffix(meta, ";base64")
+
+		buf, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("decoding base64 data: %w", err)
+		}
+
+		body = buf
+	} else {
+		s, err := url.PathUnescape(data)
+		if err != nil {
+			return nil, fmt.Errorf("decoding data: %w", err)
+		}
+
+		body = []byte(s)
+	}
+
+	header := http.Header{}
+	if meta != "" {
+		header.Set("Content-Type", meta)
+	}
+
+	return &dataSource{resp: SourceResponse{Body: body, Header: header}}, nil
+}
+
+func (s *dataSource) Fetch(ctx context.Context) (*SourceResponse, error) {
+	resp := s.resp
+	return &resp, nil
+}
@@ -0,0 +1,78 @@
+package jwksclient
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestFileSourceConcurrentRefresh(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "jwks.json")
+
+	// replaces the file atomically with a key set of n keys, the size changes even within the mtime granularity
+	write := func(n int) {
+		kids := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			kids = append(kids, fmt.Sprintf("k%d", i))
+		}
+
+		tmp := filepath.Join(dir, "jwks.tmp")
+		if err := os.WriteFile(tmp, mkJWKS(kids...), 0o600); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := os.Rename(tmp, path); err != nil {
+			t.Error(err)
+		}
+	}
+
+	write(1)
+
+	cfg := NewConfig()
+	cfg.URL = "file://" + path
+
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal("New() error:", err)
+	}
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for n := 2; n <= 50; n++ {
+			write(n)
+		}
+	}()
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				if _, err := c.Refresh(true); err != nil {
+					t.Errorf("Refresh() error: %v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// the final file is always picked up
+	if _, err := c.Refresh(true); err != nil {
+		t.Fatal("Refresh() error:", err)
+	}
+
+	if got := c.Status().KeyCount; got != 50 {
+		t.Errorf("got %d keys, want 50", got)
+	}
+}
@@ -0,0 +1,110 @@
+package jwksclient
+
+import (
+	"time"
+
+	"github.com/dimovnike/go-jwksclient/internal/snapshot"
+)
+
+// CacheDecision tells how the expiration of the cached response was determined
+type CacheDecision string
+
+const (
+	// CacheDecisionHeaders means the cache headers were used as is
+	CacheDecisionHeaders CacheDecision = "headers"
+
+	// CacheDecisionMinClamped means the cache headers were below CacheMin
+	CacheDecisionMinClamped CacheDecision = "min-clamped"
+
+	// CacheDecisionMaxClamped means the cache headers were above CacheMax
+	CacheDecisionMaxClamped CacheDecision = "max-clamped"
+
+	// CacheDecisionDefault means there were no usable cache headers and CacheMin was used
+	CacheDecisionDefault CacheDecision = "default"
+
+	// CacheDecisionError means the last refresh failed and CacheErrors was used
+	CacheDecisionError CacheDecision = "error"
+)
+
+// Status is a snapshot of the client state, see Client.Status
+type Status struct {
+	URL string `json:"url"`
+
+	LastAttempt time.Time `json:"lastAttempt"`
+	LastSuccess time.Time `json:"lastSuccess"`
+	NextRefresh time.Time `json:"nextRefresh"`
+
+	// LastError is the error of the last refresh, nil if it succeeded
+	LastError        error  `json:"-"`
+	LastErrorMessage string `json:"lastError,omitempty"`
+
+	// KeysStaleSince is set when the refresh fails and the previous keys are kept
+	KeysStaleSince   time.Time `json:"keysStaleSince"`
+	ServingStaleKeys bool      `json:"servingStaleKeys"`
+
+	KeyCount int      `json:"keyCount"`
+	KeyIDs   []string `json:"keyIds"`
+
+	// RejectedKeys maps the excluded keys, as "#index:kid", to the reason, see WithX5CValidation
+	RejectedKeys map[string]string `json:"rejectedKeys,omitempty"`
+
+	HTTPStatus    int           `json:"httpStatus"`
+	CacheDecision CacheDecision `json:"cacheDecision"`
+
+	// PendingKeySet is the key set held back by the shrinkage check, nil if there is none
+	PendingKeySet *PendingKeySet `json:"pendingKeySet,omitempty"`
+
+	// ShrinkDecision is the last decision of the shrinkage check
+	ShrinkDecision string `json:"shrinkDecision,omitempty"`
+
+	// Shadow holds the comparison counters, nil if no shadow URL is configured
+	Shadow *ShadowStatus `json:"shadow,omitempty"`
+}
+
+// Status returns a snapshot of the client state, useful for admin pages and alerts
+func (c *Client) Status() Status {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	return c.status()
+}
+
+// status builds the snapshot, the caller holds c.m
+func (c *Client) status() Status {
+	st := Status{
+		URL:            c.config.URL,
+		LastAttempt:    c.lastAttempt,
+		LastSuccess:    c.lastSuccess,
+		NextRefresh:    c.cacheExpiresAfter,
+		LastError:      c.cachedError,
+		KeysStaleSince: c.keysStaleSince,
+		KeyIDs:         snapshot.KeyIDs(c.cachedJWKSet),
+		RejectedKeys:   snapshot.CopyMap(c.rejectedKeys),
+		HTTPStatus:     c.lastStatusCode,
+		CacheDecision:  c.cacheDecision,
+	}
+
+	if c.cachedError != nil {
+		st.LastErrorMessage = c.cachedError.Error()
+
+		st.ServingStaleKeys = c.cachedJWKSet != nil && !c.keysStaleSince.Add(c.config.KeepStaleKeys).Before(time.Now())
+	}
+
+	if c.cachedJWKSet != nil {
+		st.KeyCount = c.cachedJWKSet.Len()
+	}
+
+	if p := c.shrinkage.pending; p != nil {
+		pending := *p
+		pending.KeyIDs = append([]string(nil), p.KeyIDs...)
+		st.PendingKeySet = &pending
+	}
+
+	st.ShrinkDecision = c.shrinkage.decision
+
+	if c.shadow != nil {
+		st.Shadow = c.shadow.getStatus()
+	}
+
+	return st
+}
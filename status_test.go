@@ -0,0 +1,163 @@
+package jwksclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStatusCacheDecision(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		statusCode   int
+		want         CacheDecision
+
+		// the expected time from the attempt to the next refresh
+		wantNext time.Duration
+	}{
+		{name: "headers", cacheControl: "max-age=600", want: CacheDecisionHeaders, wantNext: 10 * time.Minute},
+		{name: "min clamped", cacheControl: "max-age=10", want: CacheDecisionMinClamped, wantNext: time.Minute},
+		{name: "max clamped", cacheControl: "max-age=7200", want: CacheDecisionMaxClamped, wantNext: time.Hour},
+		{name: "default", want: CacheDecisionDefault, wantNext: time.Minute},
+		{name: "error", statusCode: http.StatusInternalServerError, want: CacheDecisionError, wantNext: 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.cacheControl != "" {
+					w.Header().Set("Cache-Control", tt.cacheControl)
+				}
+
+				if tt.statusCode != 0 {
+					w.WriteHeader(tt.statusCode)
+					return
+				}
+
+				w.Write(mkJWKS("k1"))
+			}))
+			defer srv.Close()
+
+			cfg := NewConfig()
+			cfg.URL = srv.URL
+
+			c, err := New(cfg)
+			if err != nil {
+				t.Fatal("New() error:", err)
+			}
+
+			c.Refresh(true)
+
+			st := c.Status()
+
+			if st.CacheDecision != tt.want {
+				t.Errorf("Status().CacheDecision = %s, want %s", st.CacheDecision, tt.want)
+			}
+
+			// the expiration is computed right after the attempt
+			if next := st.NextRefresh.Sub(st.LastAttempt); next < tt.wantNext || next > tt.wantNext+time.Second {
+				t.Errorf("Status().NextRefresh is %s after the attempt, want %s", next, tt.wantNext)
+			}
+
+			if tt.statusCode != 0 && (st.LastError == nil || st.HTTPStatus != tt.statusCode) {
+				t.Errorf("Status() LastError = %v, HTTPStatus = %d, want an error and %d", st.LastError, st.HTTPStatus, tt.statusCode)
+			}
+		})
+	}
+}
+
+func TestStatusServingStaleKeys(t *testing.T) {
+	var fail int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		w.Write(mkJWKS("k1", "k2"))
+	}))
+	defer srv.Close()
+
+	cfg := NewConfig()
+	cfg.URL = srv.URL
+
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal("New() error:", err)
+	}
+
+	if _, err := c.Refresh(true); err != nil {
+		t.Fatal("Refresh() error:", err)
+	}
+
+	if st := c.Status(); st.ServingStaleKeys || !st.KeysStaleSince.IsZero() || st.LastError != nil {
+		t.Errorf("Status() = %+v, want fresh keys", st)
+	}
+
+	atomic.StoreInt32(&fail, 1)
+
+	if _, err := c.Refresh(true); err == nil {
+		t.Fatal("Refresh() succeeded, want an error")
+	}
+
+	st := c.Status()
+
+	if !st.ServingStaleKeys || st.KeysStaleSince.IsZero() {
+		t.Errorf("Status() ServingStaleKeys = %v, KeysStaleSince = %v, want stale keys", st.ServingStaleKeys, st.KeysStaleSince)
+	}
+
+	if st.KeyCount != 2 || st.LastErrorMessage == "" || !st.LastSuccess.Before(st.LastAttempt) {
+		t.Errorf("Status() = %+v, want the cached keys, the error and an older success", st)
+	}
+}
+
+func TestStatusNextRefresh(t *testing.T) {
+	var requests int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(mkJWKS("k1"))
+	}))
+	defer srv.Close()
+
+	cfg := NewConfig()
+	cfg.URL = srv.URL
+	cfg.CacheMin = 100 * time.Millisecond
+
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal("New() error:", err)
+	}
+
+	if _, err := c.Refresh(true); err != nil {
+		t.Fatal("Refresh() error:", err)
+	}
+
+	next := c.Status().NextRefresh
+
+	// before NextRefresh the cache is still valid
+	if refreshed, err := c.Refresh(false); refreshed || err != nil {
+		t.Errorf("Refresh() = %v, %v before NextRefresh, want no refresh", refreshed, err)
+	}
+
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("got %d requests before NextRefresh, want 1", got)
+	}
+
+	time.Sleep(time.Until(next) + 10*time.Millisecond)
+
+	if refreshed, err := c.Refresh(false); !refreshed || err != nil {
+		t.Errorf("Refresh() = %v, %v after NextRefresh, want a refresh", refreshed, err)
+	}
+
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("got %d requests after NextRefresh, want 2", got)
+	}
+
+	if st := c.Status(); !st.NextRefresh.After(next) {
+		t.Errorf("Status().NextRefresh = %v, want it after %v", st.NextRefresh, next)
+	}
+}
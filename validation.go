@@ -0,0 +1,147 @@
+package jwksclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+var (
+	// DefaultContentTypes are accepted when Config.AllowedContentTypes is empty
+	DefaultContentTypes = []string{"application/json", "application/jwk-set+json"}
+
+	// DefaultSignedContentTypes are accepted for signed key sets when Config.AllowedContentTypes is empty
+	DefaultSignedContentTypes = []string{"application/jwt", "application/jwk-set+jwt", "application/entity-statement+jwt"}
+)
+
+// ResponseTooLargeError is returned when the response body exceeds Config.MaxResponseSize
+type ResponseTooLargeError struct {
+	Limit int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("response body exceeds %d bytes", e.Limit)
+}
+
+// ContentTypeError is returned when the Content-Type of the response is not allowed
+type ContentTypeError struct {
+	ContentType string
+	Allowed     []string
+}
+
+func (e *ContentTypeError) Error() string {
+	return fmt.Sprintf("content type %q not allowed, expected one of: %s", e.ContentType, strings.Join(e.Allowed, ", "))
+}
+
+// DuplicateMemberError is returned in strict JSON mode when an object has the same member twice
+type DuplicateMemberError struct {
+	// the path of the object, e.g. $.keys[0]
+	Path   string
+	Member string
+}
+
+func (e *DuplicateMemberError) Error() string {
+	return fmt.Sprintf("duplicate JSON member %q in %s", e.Member, e.Path)
+}
+
+// TrailingDataError is returned in strict JSON mode when there is data after the JSON value,
+// without strict mode such a response fails to parse with a generic error
+type TrailingDataError struct {
+	Offset int64
+}
+
+func (e *TrailingDataError) Error() string {
+	return fmt.Sprintf("trailing data after JSON value at offset %d", e.Offset)
+}
+
+// checkContentType checks the Content-Type header against the allowed types, parameters like charset are ignored
+func (c *Client) checkContentType(contentType string) error {
+	allowed := c.config.AllowedContentTypes
+	if len(allowed) == 0 {
+		allowed = DefaultContentTypes
+		if c.signed != nil {
+			allowed = DefaultSignedContentTypes
+		}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		for _, a := range allowed {
+			if strings.EqualFold(mediaType, a) {
+				return nil
+			}
+		}
+	}
+
+	return &ContentTypeError{ContentType: contentType, Allowed: allowed}
+}
+
+// checkStrictJSON rejects duplicate object members, which encoding/json silently accepts keeping the last one
+// trailing data is rejected by json.Unmarshal anyway, it is checked here only to report it as TrailingDataError
+func checkStrictJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if err := checkStrictValue(dec, "$"); err != nil {
+		return err
+	}
+
+	offset := dec.InputOffset()
+
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return &TrailingDataError{Offset: offset}
+	}
+
+	return nil
+}
+
+// checkStrictValue walks a single JSON value
+func checkStrictValue(dec *json.Decoder, path string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		seen := map[string]bool{}
+
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+
+			member, _ := tok.(string)
+			if seen[member] {
+				return &DuplicateMemberError{Path: path, Member: member}
+			}
+
+			seen[member] = true
+
+			if err := checkStrictValue(dec, path+"."+member); err != nil {
+				return err
+			}
+		}
+
+		// the closing delimiter
+		_, err := dec.Token()
+		return err
+
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			if err := checkStrictValue(dec, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+		_, err := dec.Token()
+		return err
+	}
+
+	return nil
+}
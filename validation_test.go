@@ -0,0 +1,75 @@
+package jwksclient
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckStrictJSON(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		wantDuplicate bool
+		wantTrailing  bool
+		wantErr       bool
+	}{
+		{
+			name: "valid key set",
+			data: `{"keys":[{"kty":"oct","k":"AAAA","kid":"a"},{"kty":"oct","k":"AAAA","kid":"b"}]}`,
+		},
+		{
+			name: "trailing whitespace",
+			data: "{\"keys\":[]}\n\t ",
+		},
+		{
+			name:          "duplicate top level member",
+			data:          `{"keys":[],"keys":[{"kty":"oct","k":"AAAA"}]}`,
+			wantDuplicate: true,
+		},
+		{
+			name:          "duplicate member in key",
+			data:          `{"keys":[{"kty":"oct","kid":"a","kid":"b"}]}`,
+			wantDuplicate: true,
+		},
+		{
+			name: "same member in different objects",
+			data: `{"keys":[{"kid":"a"},{"kid":"b"}],"x":{"kid":"c"}}`,
+		},
+		{
+			name:         "trailing value",
+			data:         `{"keys":[]}{"keys":[]}`,
+			wantTrailing: true,
+		},
+		{
+			name:         "trailing garbage",
+			data:         `{"keys":[]} <html>`,
+			wantTrailing: true,
+		},
+		{
+			name:    "truncated",
+			data:    `{"keys":[`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkStrictJSON([]byte(tt.data))
+
+			var dupErr *DuplicateMemberError
+			var trailErr *TrailingDataError
+
+			if got := errors.As(err, &dupErr); got != tt.wantDuplicate {
+				t.Errorf("checkStrictJSON() error = %v, want DuplicateMemberError %v", err, tt.wantDuplicate)
+			}
+
+			if got := errors.As(err, &trailErr); got != tt.wantTrailing {
+				t.Errorf("checkStrictJSON() error = %v, want TrailingDataError %v", err, tt.wantTrailing)
+			}
+
+			wantErr := tt.wantErr || tt.wantDuplicate || tt.wantTrailing
+			if (err != nil) != wantErr {
+				t.Errorf("checkStrictJSON() error = %v, wantErr %v", err, wantErr)
+			}
+		})
+	}
+}
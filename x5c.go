@@ -0,0 +1,120 @@
+package jwksclient
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+// X5CPolicy configures the validation of the x5c certificate chains carried by the keys
+type X5CPolicy struct {
+	// the pool the chains must lead to, required
+	Roots *x509.CertPool
+
+	// exclude keys without a x5c chain, by default they are kept as is
+	RequireX5C bool
+
+	// the extended key usages accepted for the leaf certificate, empty means any
+	KeyUsages []x509.ExtKeyUsage
+}
+
+// WithX5CValidation validates the x5c chain of each key, keys that do not pass are excluded from the key set
+// the leaf public key must match the key and all certificates must be within their validity window
+// the excluded keys are logged and reported in Status
+func WithX5CValidation(policy X5CPolicy) Option {
+	return func(c *Client) {
+		c.x5cPolicy = &policy
+	}
+}
+
+func (p *X5CPolicy) validate() error {
+	if p.Roots == nil {
+		return errors.New("x5c validation requires a root pool")
+	}
+
+	return nil
+}
+
+// filter returns the keys that pass the validation and the reasons for the excluded ones,
+// by the position of the key in the set followed by the kid, as in "#2:kid", so keys sharing a kid are all reported
+func (p *X5CPolicy) filter(ks jwk.Set, now time.Time) (jwk.Set, map[string]string) {
+	valid := jwk.NewSet()
+	rejected := map[string]string{}
+
+	i := 0
+	for it := ks.Iterate(context.Background()); it.Next(context.Background()); i++ {
+		key := it.Pair().Value.(jwk.Key)
+
+		if err := p.check(key, now); err != nil {
+			name := fmt.Sprintf("#%d", i)
+			if kid := key.KeyID(); kid != "" {
+				name += ":" + kid
+			}
+
+			rejected[name] = err.Error()
+			continue
+		}
+
+		valid.Add(key)
+	}
+
+	return valid, rejected
+}
+
+// check validates the x5c chain of a single key
+func (p *X5CPolicy) check(key jwk.Key, now time.Time) error {
+	chain := key.X509CertChain()
+	if len(chain) == 0 {
+		if p.RequireX5C {
+			return errors.New("x5c chain missing")
+		}
+
+		return nil
+	}
+
+	leaf := chain[0]
+
+	if now.Before(leaf.NotBefore) {
+		return fmt.Errorf("certificate not yet valid, valid from %s", leaf.NotBefore)
+	}
+
+	if now.After(leaf.NotAfter) {
+		return fmt.Errorf("certificate expired at %s", leaf.NotAfter)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	keyUsages := p.KeyUsages
+	if len(keyUsages) == 0 {
+		keyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         p.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     keyUsages,
+	}); err != nil {
+		return fmt.Errorf("certificate chain not trusted: %w", err)
+	}
+
+	pub, err := jwk.PublicRawKeyOf(key)
+	if err != nil {
+		return fmt.Errorf("getting public key: %w", err)
+	}
+
+	leafPub, ok := leaf.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !leafPub.Equal(pub) {
+		return errors.New("certificate public key does not match the key")
+	}
+
+	return nil
+}
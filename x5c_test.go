@@ -0,0 +1,179 @@
+package jwksclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+func TestX5CFilter(t *testing.T) {
+	now := time.Now()
+
+	root, rootKey := mkCert(t, nil, nil, now.Add(-time.Hour), now.Add(time.Hour))
+	otherRoot, otherRootKey := mkCert(t, nil, nil, now.Add(-time.Hour), now.Add(time.Hour))
+
+	leaf, leafKey := mkCert(t, root, rootKey, now.Add(-time.Hour), now.Add(time.Hour))
+	expired, expiredKey := mkCert(t, root, rootKey, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	untrusted, untrustedKey := mkCert(t, otherRoot, otherRootKey, now.Add(-time.Hour), now.Add(time.Hour))
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	tests := []struct {
+		name         string
+		keys         []json.RawMessage
+		wantValid    int
+		wantRejected map[string]string
+	}{
+		{
+			name:      "valid chain",
+			keys:      []json.RawMessage{mkX5CKey(t, "k1", &leafKey.PublicKey, leaf)},
+			wantValid: 1,
+		},
+		{
+			name:         "expired chain",
+			keys:         []json.RawMessage{mkX5CKey(t, "k1", &expiredKey.PublicKey, expired)},
+			wantRejected: map[string]string{"#0:k1": "certificate expired"},
+		},
+		{
+			name:         "untrusted root",
+			keys:         []json.RawMessage{mkX5CKey(t, "k1", &untrustedKey.PublicKey, untrusted)},
+			wantRejected: map[string]string{"#0:k1": "certificate chain not trusted"},
+		},
+		{
+			name:         "leaf does not match the key",
+			keys:         []json.RawMessage{mkX5CKey(t, "k1", &otherKey.PublicKey, leaf)},
+			wantRejected: map[string]string{"#0:k1": "does not match the key"},
+		},
+		{
+			name: "keys sharing a kid are reported separately",
+			keys: []json.RawMessage{
+				mkX5CKey(t, "k1", &leafKey.PublicKey, leaf),
+				mkX5CKey(t, "k1", &expiredKey.PublicKey, expired),
+				mkX5CKey(t, "k1", &untrustedKey.PublicKey, untrusted),
+			},
+			wantValid: 1,
+			wantRejected: map[string]string{
+				"#1:k1": "certificate expired",
+				"#2:k1": "certificate chain not trusted",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := json.Marshal(map[string]interface{}{"keys": tt.keys})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ks, err := jwk.Parse(doc)
+			if err != nil {
+				t.Fatal("jwk.Parse() error:", err)
+			}
+
+			policy := X5CPolicy{Roots: roots}
+
+			valid, rejected := policy.filter(ks, now)
+
+			if valid.Len() != tt.wantValid {
+				t.Errorf("got %d valid keys, want %d", valid.Len(), tt.wantValid)
+			}
+
+			if len(rejected) != len(tt.wantRejected) {
+				t.Errorf("got rejected %v, want %v", rejected, tt.wantRejected)
+			}
+
+			for name, reason := range tt.wantRejected {
+				if !strings.Contains(rejected[name], reason) {
+					t.Errorf("rejected[%q] = %q, want it to contain %q", name, rejected[name], reason)
+				}
+			}
+		})
+	}
+}
+
+// mkCert creates a certificate valid between notBefore and notAfter, signed by parent or self signed CA when parent is nil
+func mkCert(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, notBefore, notAfter time.Time) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: serial.String()},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+// mkX5CKey returns the JWK of pub with the certificate as its x5c chain
+func mkX5CKey(t *testing.T, kid string, pub *ecdsa.PublicKey, cert *x509.Certificate) json.RawMessage {
+	t.Helper()
+
+	key, err := jwk.New(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := json.Marshal(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	m["kid"] = kid
+	m["x5c"] = []string{base64.StdEncoding.EncodeToString(cert.Raw)}
+
+	buf, err = json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf
+}